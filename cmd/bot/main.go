@@ -10,10 +10,17 @@ import (
 	"sync"
 	"time"
 	"encoding/json"
+	"bytes"
 	"io"
 	"net/http"
+	"net"
+	"errors"
+	"path/filepath"
+	"math"
+	"context"
 
 	"discord-bot/internal/config"
+	"discord-bot/internal/lyrics"
 	"discord-bot/internal/openrouter"
 	"discord-bot/internal/ytdlp"
 	"discord-bot/internal/music"
@@ -26,8 +33,9 @@ import (
 type Bot struct {
 	Session             *discordgo.Session
 	OpenRouter          *openrouter.Client
-	MusicPlayer         *music.Player
+	MusicPlayers        *music.Manager
 	Downloader          *ytdlp.Downloader
+	Downloads           *ytdlp.Queue
 	Config              *config.Config
 	RateLimiter         *security.RateLimiter
 	MessageCounters     map[string]int // channelID -> message count
@@ -35,7 +43,29 @@ type Bot struct {
 	VoiceChannelManager *VoiceChannelManager
 	SearchClient        *search.Client
 	mu                  sync.Mutex
-	LastChannelID       string // To store the last channel ID for tool responses
+	MusicSearches       map[string]*MusicSearch // messageID -> pending /search-music results
+	MusicState          *music.StateStore
+	PendingRestores     map[string]music.PlayerState // guildID -> saved player state, until the guild is available
+	Playlists           *music.PlaylistStore
+	History             *music.HistoryStore
+	Lyrics              lyrics.Provider
+	LyricsViews         map[string]*LyricsView   // messageID -> pages of a /lyrics message
+	LyricsSyncs         map[string]chan struct{} // guildID -> stops the running /lyrics sync
+}
+
+// MusicSearch holds /search-music results until the requester picks one
+type MusicSearch struct {
+	UserID  string
+	Results []ytdlp.Entry
+	Created time.Time
+}
+
+// LyricsView holds the pages of a /lyrics message while it can be flipped
+type LyricsView struct {
+	Track   *music.Track
+	Source  string
+	Pages   []string
+	Created time.Time
 }
 
 type MessageHistory struct {
@@ -67,25 +97,88 @@ func main() {
 		log.Fatalf("Error creating Discord session: %v", err)
 	}
 
+	downloader := ytdlp.NewDownloader()
+	downloader.SetMaxConcurrent(cfg.MaxConcurrentDownloads)
+
 	// Initialize bot components
 	bot := &Bot{
 		Session:             dg,
 		Config:              cfg,
 		OpenRouter:          openrouter.NewClient(cfg.OpenRouterAPIKey),
-		Downloader:          ytdlp.NewDownloader(),
-		MusicPlayer:         music.NewPlayer(),
+		Downloader:          downloader,
+		Downloads:           ytdlp.NewQueue(downloader, cfg.MaxDownloadsPerUser),
+		MusicPlayers:        music.NewManager(music.NewDiscordConnector(dg), music.NewFFmpegSource(), time.Duration(cfg.IdleTimeout)*time.Minute),
 		RateLimiter:         security.NewRateLimiter(5, 60), // 5 requests per minute
 		MessageCounters:     make(map[string]int),
 		MessageHistory:      make(map[string][]MessageHistory),
 		VoiceChannelManager: NewVoiceChannelManager(),
 		SearchClient:        search.NewClient(cfg.GoogleSearchAPIKey, cfg.GoogleSearchEngineID),
-		LastChannelID:       "",
+		MusicSearches:       make(map[string]*MusicSearch),
+		MusicState:          music.NewStateStore(cfg.MusicStateDir),
+		Playlists:           music.NewPlaylistStore(cfg.PlaylistDir),
+		History:             music.NewHistoryStore(cfg.HistoryDir),
+		LyricsViews:         make(map[string]*LyricsView),
+		LyricsSyncs:         make(map[string]chan struct{}),
+	}
+
+	// Lyrics come from the track's own subtitles first, then the lyrics API
+	providers := []lyrics.Provider{&lyrics.SubtitleProvider{Lookup: bot.subtitleURL}}
+	if cfg.LyricsAPIURL != "" {
+		providers = append(providers, lyrics.NewHTTPProvider(cfg.LyricsAPIURL))
+	}
+	bot.Lyrics = lyrics.Chain(providers...)
+
+	// Queues saved before the last shutdown are restored once their guild is available
+	bot.PendingRestores, err = bot.MusicState.Load()
+	if err != nil {
+		log.Printf("Failed to load saved music queues: %v", err)
+	}
+	bot.MusicPlayers.SetStore(bot.MusicState)
+
+	// Normalization, crossfade and segment skipping stay set after the queue is gone
+	bot.MusicPlayers.SetSettingsStore(music.NewSettingsStore(filepath.Join(cfg.MusicStateDir, "settings")))
+	bot.MusicPlayers.SetEmptyGrace(time.Duration(cfg.EmptyChannelGrace) * time.Second)
+
+	// Announce playback in the channel each song was requested from
+	bot.MusicPlayers.Subscribe(bot.handleMusicEvent)
+
+	// Keep every guild's listening history for /history and /back
+	bot.MusicPlayers.Subscribe(bot.History.HandleEvent)
+	bot.MusicPlayers.SetRecommender(music.RecommenderFunc(bot.recommendTracks))
+
+	// Stream URLs expire, so tracks restored from disk look theirs up again
+	bot.MusicPlayers.SetStreamResolver(music.StreamResolverFunc(func(track *music.Track) (string, error) {
+		info, err := downloader.GetInfo(track.URL)
+		if err != nil {
+			return "", err
+		}
+		return info.StreamURL, nil
+	}))
+
+	// Skip sponsor reads and the like in YouTube videos, and silence at either end
+	var segmentSources []music.SegmentSource
+	if cfg.SponsorBlockAPIURL != "" {
+		sponsorBlock := music.NewSponsorBlock(cfg.SponsorBlockAPIURL, cfg.Categories())
+		segmentSources = append(segmentSources, music.SegmentSourceFunc(func(track *music.Track) ([]music.Segment, error) {
+			if !ytdlp.IsYouTubeURL(track.URL) {
+				return nil, nil
+			}
+			return sponsorBlock.Segments(track)
+		}))
+	}
+	if cfg.TrimSilence {
+		segmentSources = append(segmentSources, music.NewSilenceDetector())
+	}
+	if len(segmentSources) > 0 {
+		bot.MusicPlayers.SetSegmentSource(music.CombineSegments(segmentSources...))
 	}
 
 	// Register event handlers
 	dg.AddHandler(bot.messageCreate)
 	dg.AddHandler(bot.ready)
+	dg.AddHandler(bot.guildCreate)
 	dg.AddHandler(bot.voiceStateUpdate)
+	dg.AddHandler(bot.interactionCreate)
 
 	// Open WebSocket connection
 	err = dg.Open()
@@ -93,11 +186,18 @@ func main() {
 		log.Fatalf("Error opening connection: %v", err)
 	}
 
+	// Tear down players of guilds that stopped listening and save the rest
+	bot.MusicPlayers.Start(15 * time.Second)
+
 	fmt.Println("Bot is now running. Press CTRL+C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	<-sc
 
+	// Save queues and leave voice before closing the Discord session
+	bot.MusicPlayers.Close()
+	bot.Downloads.Close()
+
 	// Cleanly close down the Discord session
 	dg.Close()
 }
@@ -106,9 +206,40 @@ func (b *Bot) ready(s *discordgo.Session, event *discordgo.Ready) {
 	fmt.Printf("Bot is ready as %v\n", event.User.Username)
 }
 
+func (b *Bot) guildCreate(s *discordgo.Session, g *discordgo.GuildCreate) {
+	b.mu.Lock()
+	state, ok := b.PendingRestores[g.ID]
+	delete(b.PendingRestores, g.ID)
+	b.mu.Unlock()
+
+	if ok {
+		// Joining voice blocks, don't hold up the event loop
+		go b.restoreMusic(s, g.Guild, state)
+	}
+}
+
 func (b *Bot) voiceStateUpdate(s *discordgo.Session, vs *discordgo.VoiceStateUpdate) {
 	// Handle join to create voice channel
 	b.handleVoiceStateUpdate(s, vs)
+
+	// Pause or leave when everyone has left the music channel
+	b.updateMusicListeners(s, vs)
+}
+
+func (b *Bot) interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+
+	customID := i.MessageComponentData().CustomID
+	switch {
+	case strings.HasPrefix(customID, "music_search:"):
+		b.handleMusicSearchPick(s, i, strings.TrimPrefix(customID, "music_search:"))
+	case strings.HasPrefix(customID, "music_queue:"):
+		b.handleQueuePage(s, i, strings.TrimPrefix(customID, "music_queue:"))
+	case strings.HasPrefix(customID, "lyrics:"):
+		b.handleLyricsPage(s, i, strings.TrimPrefix(customID, "lyrics:"))
+	}
 }
 
 func (b *Bot) messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
@@ -146,7 +277,7 @@ func (b *Bot) handlePrivateMessage(s *discordgo.Session, m *discordgo.MessageCre
 		return
 	}
 
-	b.handleAIResponse(s, m.ChannelID, response)
+	b.handleAIResponse(s, m.ChannelID, m.Author.ID, response)
 }
 
 func (b *Bot) handleGuildMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
@@ -185,8 +316,14 @@ func (b *Bot) handleCommandMessage(s *discordgo.Session, m *discordgo.MessageCre
 		b.handleAICommand(s, m, args)
 	case "download", "dl":
 		b.handleDownloadCommand(s, m, args)
+	case "jobs":
+		b.handleJobsCommand(s, m)
+	case "cancel":
+		b.handleCancelCommand(s, m, args)
 	case "play":
 		b.handlePlayCommand(s, m, args)
+	case "search-music":
+		b.handleSearchMusicCommand(s, m, args)
 	case "pause":
 		b.handlePauseCommand(s, m)
 	case "resume":
@@ -196,9 +333,49 @@ func (b *Bot) handleCommandMessage(s *discordgo.Session, m *discordgo.MessageCre
 	case "stop":
 		b.handleStopCommand(s, m)
 	case "queue":
-		b.handleQueueCommand(s, m)
+		b.handleQueueCommand(s, m, args)
+	case "move":
+		b.handleMoveCommand(s, m, args)
+	case "remove":
+		b.handleRemoveCommand(s, m, args)
+	case "clear":
+		b.handleClearCommand(s, m)
+	case "skipto":
+		b.handleSkipToCommand(s, m, args)
+	case "playnext":
+		b.handlePlayNextCommand(s, m, args)
 	case "volume":
 		b.handleVolumeCommand(s, m, args)
+	case "loop", "repeat":
+		b.handleLoopCommand(s, m, args)
+	case "shuffle":
+		b.handleShuffleCommand(s, m, args)
+	case "seek":
+		b.handleSeekCommand(s, m, args)
+	case "radio":
+		b.handleRadioCommand(s, m, args)
+	case "filter", "filters":
+		b.handleFilterCommand(s, m, args)
+	case "normalize":
+		b.handleNormalizeCommand(s, m, args)
+	case "crossfade":
+		b.handleCrossfadeCommand(s, m, args)
+	case "autoplay":
+		b.handleAutoplayCommand(s, m, args)
+	case "sponsorblock":
+		b.handleSponsorBlockCommand(s, m, args)
+	case "playlist", "pl":
+		b.handlePlaylistCommand(s, m, args)
+	case "history":
+		b.handleHistoryCommand(s, m, args)
+	case "replay":
+		b.handleReplayCommand(s, m, args)
+	case "back", "previous":
+		b.handleBackCommand(s, m)
+	case "nowplaying", "np":
+		b.handleNowPlayingCommand(s, m)
+	case "lyrics":
+		b.handleLyricsCommand(s, m, args)
 	case "help":
 		b.handleHelpCommand(s, m)
 	default:
@@ -264,7 +441,7 @@ func (b *Bot) sendProactiveAIResponse(s *discordgo.Session, channelID string) {
 		return
 	}
 
-	b.handleAIResponse(s, channelID, response)
+	b.handleAIResponse(s, channelID, "", response)
 }
 
 func (b *Bot) handleAICommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
@@ -290,13 +467,12 @@ func (b *Bot) handleAICommand(s *discordgo.Session, m *discordgo.MessageCreate,
 		return
 	}
 
-	b.handleAIResponse(s, m.ChannelID, response)
+	b.handleAIResponse(s, m.ChannelID, m.Author.ID, response)
 }
 
-func (b *Bot) handleAIResponse(s *discordgo.Session, channelID string, response *openrouter.ChatResponse) {
-	// Store the channel ID for tool responses
-	b.LastChannelID = channelID
-
+// handleAIResponse answers in channelID, running any tools the AI asks
+// for on behalf of userID, which is "" for proactive responses.
+func (b *Bot) handleAIResponse(s *discordgo.Session, channelID, userID string, response *openrouter.ChatResponse) {
 	if len(response.Choices) > 0 {
 		choice := response.Choices[0]
 		
@@ -304,7 +480,7 @@ func (b *Bot) handleAIResponse(s *discordgo.Session, channelID string, response
 		if len(choice.ToolCalls) > 0 {
 			// Process tool calls
 			for _, toolCall := range choice.ToolCalls {
-				result := b.executeTool(toolCall.Function.Name, toolCall.Function.Arguments)
+				result := b.executeTool(channelID, userID, toolCall.Function.Name, toolCall.Function.Arguments)
 				
 				// Send the result back to the AI
 				messages := []openrouter.Message{
@@ -335,22 +511,22 @@ func (b *Bot) handleAIResponse(s *discordgo.Session, channelID string, response
 	}
 }
 
-func (b *Bot) executeTool(name, arguments string) string {
+func (b *Bot) executeTool(channelID, userID, name, arguments string) string {
 	switch name {
 	case "download_video":
-		return b.executeDownloadVideo(arguments)
+		return b.executeDownloadVideo(channelID, userID, arguments)
 	case "play_music":
-		return b.executePlayMusic(arguments)
+		return b.executePlayMusic(channelID, userID, arguments)
 	case "get_video_info":
 		return b.executeGetVideoInfo(arguments)
 	case "search_web":
-		return b.executeSearchWeb(arguments)
+		return b.executeSearchWeb(channelID, arguments)
 	default:
 		return fmt.Sprintf("Unknown tool: %s", name)
 	}
 }
 
-func (b *Bot) executeDownloadVideo(arguments string) string {
+func (b *Bot) executeDownloadVideo(channelID, userID, arguments string) string {
 	var args struct {
 		URL    string `json:"url"`
 		Format string `json:"format"`
@@ -360,38 +536,121 @@ func (b *Bot) executeDownloadVideo(arguments string) string {
 		return fmt.Sprintf("Error parsing arguments: %v", err)
 	}
 	
-	audioOnly := args.Format == "audio"
-	
-	opts := ytdlp.DownloadOptions{
-		URL:      args.URL,
-		Audio:    audioOnly,
-		NoCookie: true,
+	// Downloads count against whoever asked, like /download, so proactive
+	// responses with nobody asking can't start them
+	if userID == "" {
+		return "Downloads have to be asked for by someone."
+	}
+	if !security.ValidateURL(args.URL) {
+		return "Invalid URL provided."
 	}
 	
-	filename, err := b.Downloader.DownloadVideo(opts)
+	// Progress and the finished file go to a status message in the
+	// channel, so the reply doesn't wait for the download
+	job, position, err := b.startDownload(b.Session, channelID, b.guildFromChannel(channelID), userID, args.URL, args.Format == "audio")
 	if err != nil {
 		return fmt.Sprintf("Error downloading: %v", err)
 	}
 	
-	return fmt.Sprintf("Download completed: %s", filename)
+	if position > 0 {
+		return fmt.Sprintf("Download #%d queued at position %d. Its progress is shown in the channel and the file is posted there when done.", job.ID, position)
+	}
+	return fmt.Sprintf("Download #%d started. Its progress is shown in the channel and the file is posted there when done.", job.ID)
 }
 
-func (b *Bot) executePlayMusic(arguments string) string {
+func (b *Bot) executePlayMusic(channelID, userID, arguments string) string {
 	var args struct {
-		URL string `json:"url"`
+		Query string `json:"query"`
+		URL   string `json:"url"`
 	}
 	
 	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
 		return fmt.Sprintf("Error parsing arguments: %v", err)
 	}
 	
-	track := &music.Track{
-		Title: args.URL,
-		URL:   args.URL,
+	// Older tool calls still send a url
+	query := args.Query
+	if query == "" {
+		query = args.URL
 	}
 	
-	b.MusicPlayer.AddToQueue(track)
-	return fmt.Sprintf("Added to queue: %s", args.URL)
+	guildID := b.guildFromChannel(channelID)
+	if guildID == "" {
+		return "Music can only be played in a server."
+	}
+
+	// Tracks belong to whoever asked, like with /play, for vote skips and /remove
+	if userID == "" {
+		return "Music has to be asked for by someone."
+	}
+
+	track, err := b.resolveQuery(query)
+	if err != nil {
+		return fmt.Sprintf("Error adding track: %v", err)
+	}
+	track.Requester = userID
+	track.ChannelID = channelID
+
+	player := b.MusicPlayers.Get(guildID)
+	player.AddToQueue(track)
+
+	// The AI has no voice channel to join, so only start if we're already connected
+	if player.IsConnectedToVoice() && player.GetCurrentTrack() == nil {
+		player.Play()
+	}
+
+	return fmt.Sprintf("Added to queue: %s", track.Title)
+}
+
+// resolveQuery resolves a URL, or the top YouTube search result for free text
+func (b *Bot) resolveQuery(query string) (*music.Track, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("nothing to play")
+	}
+
+	if isURL(query) {
+		if !security.ValidateURL(query) {
+			return nil, fmt.Errorf("invalid URL provided")
+		}
+		return b.resolveTrack(query)
+	}
+
+	return b.resolveTrack("ytsearch1:" + query)
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// resolveTrack looks up a URL's metadata and audio stream, enforcing the
+// configured maximum track length.
+func (b *Bot) resolveTrack(url string) (*music.Track, error) {
+	info, err := b.Downloader.GetInfo(url)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := time.Duration(math.Round(info.Duration)) * time.Second
+	maxLength := time.Duration(b.Config.MaxTrackLength) * time.Minute
+	if maxLength > 0 && duration > maxLength {
+		return nil, fmt.Errorf("track is %s long, the limit is %s", music.FormatDuration(duration), music.FormatDuration(maxLength))
+	}
+
+	pageURL := info.WebpageURL
+	if pageURL == "" {
+		pageURL = url
+	}
+
+	return &music.Track{
+		ID:        info.ID,
+		Title:     info.Title,
+		URL:       pageURL,
+		Duration:  duration,
+		Thumbnail: info.Thumbnail,
+		Uploader:  info.Uploader,
+		StreamURL: info.StreamURL,
+	}, nil
 }
 
 func (b *Bot) executeGetVideoInfo(arguments string) string {
@@ -411,7 +670,7 @@ func (b *Bot) executeGetVideoInfo(arguments string) string {
 	return fmt.Sprintf("Video info: %+v", info)
 }
 
-func (b *Bot) executeSearchWeb(arguments string) string {
+func (b *Bot) executeSearchWeb(channelID, arguments string) string {
 	var args struct {
 		Query string `json:"query"`
 	}
@@ -446,7 +705,7 @@ func (b *Bot) executeSearchWeb(arguments string) string {
 	allContent := strings.Join(scrapedContents, "\n\n---\n\n")
 	
 	// Step 4: Ask AI to summarize the search results
-	summary, err := b.summarizeSearchResults(allContent)
+	summary, err := b.summarizeSearchResults(channelID, allContent)
 	if err != nil {
 		return fmt.Sprintf("Error summarizing results: %v", err)
 	}
@@ -454,11 +713,9 @@ func (b *Bot) executeSearchWeb(arguments string) string {
 	return fmt.Sprintf("**Search Results for '%s':**\n\n%s", args.Query, summary)
 }
 
-func (b *Bot) summarizeSearchResults(content string) (string, error) {
+func (b *Bot) summarizeSearchResults(channelID, content string) (string, error) {
 	// Send typing indicator
-	if b.LastChannelID != "" {
-		b.Session.ChannelTyping(b.LastChannelID)
-	}
+	b.Session.ChannelTyping(channelID)
 	
 	// Ask AI to summarize the search results
 	messages := []openrouter.Message{
@@ -490,9 +747,6 @@ func (b *Bot) handleDownloadCommand(s *discordgo.Session, m *discordgo.MessageCr
 		return
 	}
 
-	// Send processing message
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Downloading from %s...", url))
-
 	// Determine if audio only
 	audioOnly := false
 	for _, arg := range args {
@@ -502,99 +756,2566 @@ func (b *Bot) handleDownloadCommand(s *discordgo.Session, m *discordgo.MessageCr
 		}
 	}
 
-	opts := ytdlp.DownloadOptions{
+	// Errors end up in the download's status message
+	b.startDownload(s, m.ChannelID, m.GuildID, m.Author.ID, url, audioOnly)
+}
+
+// startDownload queues a download for userID and follows it with a status
+// message in the channel, which ends up with the finished file. It returns
+// the job and how many jobs are ahead of it.
+func (b *Bot) startDownload(s *discordgo.Session, channelID, guildID, userID, url string, audioOnly bool) (*ytdlp.Job, int, error) {
+	// One message follows the download from the queue to the finished file
+	status, err := newDownloadStatus(s, channelID, fmt.Sprintf("Preparing download of <%s>...", url))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	job := &ytdlp.Job{
+		Owner:   userID,
+		GuildID: guildID,
+	}
+	job.Options = ytdlp.DownloadOptions{
 		URL:      url,
 		Audio:    audioOnly,
 		NoCookie: true,
+		Progress: func(progress ytdlp.Progress) {
+			status.Update(downloadProgressText(job, progress))
+		},
+	}
+	job.Started = func() {
+		status.Update(downloadProgressText(job, ytdlp.Progress{Stage: ytdlp.StageStarting}))
+	}
+	job.Done = func(result *ytdlp.DownloadResult, err error) {
+		if errors.Is(err, ytdlp.ErrCancelled) {
+			status.Finish(fmt.Sprintf("Download #%d of <%s> was cancelled.", job.ID, url))
+			return
+		}
+		if err != nil {
+			status.Finish(fmt.Sprintf("Error downloading <%s>: %v", url, err))
+			return
+		}
+
+		status.Update(fmt.Sprintf("Uploading %s...", filepath.Base(result.Path)))
+		content := fmt.Sprintf("<@%s> here is your download of **%s** (%s):", userID, result.Info.Title, ytdlp.FormatBytes(result.Size))
+		if err := b.sendDownload(job.Context(), s, channelID, content, result, audioOnly, status.Update); err != nil {
+			// Still on /jobs while uploading, so it can be cancelled then too
+			if job.Context().Err() != nil {
+				status.Finish(fmt.Sprintf("Download #%d of <%s> was cancelled.", job.ID, url))
+				return
+			}
+			status.Finish(fmt.Sprintf("Error sending <%s>: %v", url, err))
+			return
+		}
+		status.Finish(fmt.Sprintf("Download of <%s> completed.", url))
 	}
 
-	filename, err := b.Downloader.DownloadVideo(opts)
+	// Downloads run on the queue's workers, not in the event handler
+	position, err := b.Downloads.Submit(job)
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error downloading: %v", err))
+		status.Finish(fmt.Sprintf("Error queueing download: %v", err))
+		return nil, 0, err
+	}
+
+	if position > 0 {
+		status.Queued(fmt.Sprintf("Download #%d of <%s> queued at position %d. Use /cancel %d to cancel it.", job.ID, url, position, job.ID))
+	}
+	return job, position, nil
+}
+
+// handleJobsCommand lists the server's running and waiting downloads
+func (b *Bot) handleJobsCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+	running, pending := b.Downloads.Jobs()
+
+	describe := func(job *ytdlp.Job) string {
+		return fmt.Sprintf("#%d <%s> - <@%s>", job.ID, job.Options.URL, job.Owner)
+	}
+
+	message := ""
+	for _, job := range running {
+		if job.GuildID == m.GuildID {
+			message += "▶️ " + describe(job) + "\n"
+		}
+	}
+	position := 0
+	for _, job := range pending {
+		// Positions count every server's downloads, as they share workers
+		position++
+		if job.GuildID == m.GuildID {
+			message += fmt.Sprintf("%d. %s\n", position, describe(job))
+		}
+	}
+
+	if message == "" {
+		s.ChannelMessageSend(m.ChannelID, "No downloads are running or queued.")
 		return
 	}
 
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Download completed: %s", filename))
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:         "Downloads:\n" + message + "\nUse /cancel <number> to cancel one.",
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
 }
 
-func (b *Bot) handlePlayCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+// handleCancelCommand stops a download. Anyone can cancel their own;
+// admins can cancel anyone's in their server.
+func (b *Bot) handleCancelCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
 	if len(args) == 0 {
-		s.ChannelMessageSend(m.ChannelID, "Please provide a URL to play.")
+		s.ChannelMessageSend(m.ChannelID, "Please provide the number of the download to cancel, see /jobs.")
 		return
 	}
 
-	url := args[0]
-	if !security.ValidateURL(url) {
-		s.ChannelMessageSend(m.ChannelID, "Invalid URL provided.")
+	var id int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(args[0], "#"), "%d", &id); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Invalid download number.")
 		return
 	}
 
-	// In a real implementation, we would:
-	// 1. Connect to voice channel
-	// 2. Add track to queue
-	// 3. Start playing if not already playing
-	
-	track := &music.Track{
-		Title: url,
-		URL:   url,
+	job, ok := b.Downloads.Get(id)
+	if !ok || job.GuildID != m.GuildID {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("There is no download #%d running or queued.", id))
+		return
 	}
-	
-	b.MusicPlayer.AddToQueue(track)
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Added to queue: %s", url))
+
+	if job.Owner != m.Author.ID && !b.isAdmin(s, m) {
+		s.ChannelMessageSend(m.ChannelID, "You can only cancel your own downloads.")
+		return
+	}
+
+	if !b.Downloads.Cancel(id) {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Download #%d has already finished.", id))
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Cancelled download #%d.", id))
 }
 
-func (b *Bot) handlePauseCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
-	b.MusicPlayer.Pause()
-	s.ChannelMessageSend(m.ChannelID, "Playback paused.")
+// downloadStatusInterval is the least time between edits of a download's
+// status message, to stay clear of Discord's rate limits
+const downloadStatusInterval = 2 * time.Second
+
+// downloadStatus keeps a single message up to date with how a download is
+// going. Progress comes in faster than Discord allows edits, so only the
+// latest is shown every downloadStatusInterval.
+type downloadStatus struct {
+	session   *discordgo.Session
+	channelID string
+	messageID string
+	finish    chan string
+
+	mu      sync.Mutex
+	text    string
+	shown   string
+	started bool
 }
 
-func (b *Bot) handleResumeCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
-	b.MusicPlayer.Play()
-	s.ChannelMessageSend(m.ChannelID, "Playback resumed.")
+func newDownloadStatus(s *discordgo.Session, channelID, text string) (*downloadStatus, error) {
+	msg, err := s.ChannelMessageSend(channelID, text)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &downloadStatus{
+		session:   s,
+		channelID: channelID,
+		messageID: msg.ID,
+		finish:    make(chan string),
+		text:      text,
+		shown:     text,
+	}
+	go status.run()
+
+	return status, nil
 }
 
-func (b *Bot) handleSkipCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
-	b.MusicPlayer.Skip()
-	s.ChannelMessageSend(m.ChannelID, "Skipped to next track.")
+// Queued shows the download's place in the queue, unless it has already
+// started by the time the position is known
+func (d *downloadStatus) Queued(text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.started {
+		d.text = text
+	}
 }
 
-func (b *Bot) handleStopCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
-	b.MusicPlayer.Stop()
-	s.ChannelMessageSend(m.ChannelID, "Playback stopped and queue cleared.")
+// Update replaces the status shown at the next edit
+func (d *downloadStatus) Update(text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.started = true
+	d.text = text
 }
 
-func (b *Bot) handleQueueCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
-	queue := b.MusicPlayer.GetQueue()
-	if len(queue) == 0 {
-		s.ChannelMessageSend(m.ChannelID, "Queue is empty.")
-		return
+// Finish shows text as the final status and stops updating the message
+func (d *downloadStatus) Finish(text string) {
+	d.finish <- text
+}
+
+func (d *downloadStatus) run() {
+	ticker := time.NewTicker(downloadStatusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case text := <-d.finish:
+			d.session.ChannelMessageEdit(d.channelID, d.messageID, text)
+			return
+		case <-ticker.C:
+		}
+
+		d.mu.Lock()
+		text := d.text
+		changed := text != d.shown
+		d.shown = text
+		d.mu.Unlock()
+
+		if changed {
+			d.session.ChannelMessageEdit(d.channelID, d.messageID, text)
+		}
 	}
+}
+
+// downloadProgressText describes a download's progress with a bar
+func downloadProgressText(job *ytdlp.Job, progress ytdlp.Progress) string {
+	text := fmt.Sprintf("Downloading <%s> (#%d, /cancel %d to stop)\n", job.Options.URL, job.ID, job.ID)
 
-	message := "Current queue:\n"
-	for i, track := range queue {
-		message += fmt.Sprintf("%d. %s\n", i+1, track.Title)
+	switch progress.Stage {
+	case ytdlp.StageStarting:
+		return text + "Looking up the video..."
+	case ytdlp.StageMerging:
+		return text + "Merging video and audio..."
+	case ytdlp.StageConverting:
+		return text + "Converting..."
+	case ytdlp.StageDone:
+		return text + "Finishing up..."
 	}
-	
-	s.ChannelMessageSend(m.ChannelID, message)
+
+	const width = 20
+	filled := int(progress.Percent / 100 * width)
+	if filled < 0 {
+		filled = 0
+	} else if filled > width {
+		filled = width
+	}
+
+	text += fmt.Sprintf("`%s%s` %s", strings.Repeat("█", filled), strings.Repeat("░", width-filled), progress)
+	if progress.Part > 1 {
+		text += fmt.Sprintf(" (part %d)", progress.Part)
+	}
+	return text
 }
 
-func (b *Bot) handleVolumeCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+// Discord's upload limits for guilds without boosts and with boost levels 2
+// and 3; level 1 adds nothing for files
+const (
+	defaultUploadLimit = 10 << 20
+	tier2UploadLimit   = 50 << 20
+	tier3UploadLimit   = 100 << 20
+)
+
+// uploadLimit returns the largest file the bot may upload to the guild:
+// Discord's limit for the guild's boost level, capped by MAX_FILE_SIZE
+func (b *Bot) uploadLimit(s *discordgo.Session, guildID string) int64 {
+	limit := int64(defaultUploadLimit)
+
+	if guildID != "" {
+		guild, err := s.State.Guild(guildID)
+		if err != nil {
+			guild, err = s.Guild(guildID)
+		}
+		if err == nil {
+			switch guild.PremiumTier {
+			case discordgo.PremiumTier2:
+				limit = tier2UploadLimit
+			case discordgo.PremiumTier3:
+				limit = tier3UploadLimit
+			}
+		}
+	}
+
+	if max := int64(b.Config.MaxFileSize) << 20; max > 0 && max < limit {
+		limit = max
+	}
+	return limit
+}
+
+// sendDownload uploads a finished download to the channel, re-encoding it
+// first when it is over the upload limit. report, if not nil, is told
+// about the re-encode. The download and any smaller copy are deleted
+// afterwards, whether or not the upload worked. Cancelling ctx stops the
+// upload.
+func (b *Bot) sendDownload(ctx context.Context, s *discordgo.Session, channelID, content string, result *ytdlp.DownloadResult, audio bool, report func(text string)) error {
+	defer result.Remove()
+
+	limit := b.uploadLimit(s, b.guildFromChannel(channelID))
+	upload := result.Path
+	if result.Size > limit {
+		if report != nil {
+			report(fmt.Sprintf("%s is %s, over the %s upload limit here. Re-encoding to fit...",
+				filepath.Base(result.Path), ytdlp.FormatBytes(result.Size), ytdlp.FormatBytes(limit)))
+		}
+
+		var err error
+		upload, err = ytdlp.ShrinkToFit(ctx, result.Path, result.Duration, limit, audio)
+		if err != nil {
+			return fmt.Errorf("the file is %s, over the %s upload limit here, and couldn't be made small enough: %v",
+				ytdlp.FormatBytes(result.Size), ytdlp.FormatBytes(limit), err)
+		}
+		defer os.Remove(upload)
+	}
+
+	file, err := os.Open(upload)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// The session's client gives up after 20 seconds, too soon for big files
+	timeout := uploadTimeout(info.Size())
+	client := &http.Client{Timeout: timeout}
+
+	_, err = s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: content,
+		Files: []*discordgo.File{{
+			Name:   filepath.Base(upload),
+			Reader: file,
+		}},
+	}, discordgo.WithClient(client), discordgo.WithContext(ctx))
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("uploading %s to Discord timed out after %s", ytdlp.FormatBytes(info.Size()), timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload: %w", err)
+	}
+
+	return nil
+}
+
+// Uploads get uploadBaseTimeout plus the time the file takes at
+// uploadMinSpeed bytes per second
+const (
+	uploadBaseTimeout = 30 * time.Second
+	uploadMinSpeed    = 256 << 10
+)
+
+// uploadTimeout returns how long an upload of size bytes may take
+func uploadTimeout(size int64) time.Duration {
+	return uploadBaseTimeout + time.Duration(size/uploadMinSpeed)*time.Second
+}
+
+func (b *Bot) handlePlayCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
 	if len(args) == 0 {
-		volume := b.MusicPlayer.GetVolume() * 100
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Current volume: %.0f%%", volume))
+		s.ChannelMessageSend(m.ChannelID, "Please provide a URL or song name to play.")
 		return
 	}
 
-	// Parse volume level
-	var volume int
-	_, err := fmt.Sscanf(args[0], "%d", &volume)
-	if err != nil || volume < 0 || volume > 100 {
-		s.ChannelMessageSend(m.ChannelID, "Please provide a valid volume level between 0 and 100.")
+	if _, err := b.userVoiceChannel(s, m.GuildID, m.Author.ID); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "You need to be in a voice channel to play music.")
 		return
 	}
 
-	b.MusicPlayer.SetVolume(float64(volume) / 100.0)
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Volume set to %d%%", volume))
+	query := strings.Join(args, " ")
+	if isURL(query) && ytdlp.IsPlaylistURL(query) {
+		b.importPlaylist(s, m, query)
+		return
+	}
+
+	// Resolving can take a few seconds
+	s.ChannelTyping(m.ChannelID)
+
+	track, err := b.resolveQuery(query)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error adding track: %v", err))
+		return
+	}
+	track.Requester = m.Author.ID
+	track.ChannelID = m.ChannelID
+
+	b.queueAndReply(s, m.GuildID, m.ChannelID, m.Author.ID, track)
+}
+
+// importPlaylist queues every entry of a playlist, reporting progress and
+// the outcome by editing a single message.
+func (b *Bot) importPlaylist(s *discordgo.Session, m *discordgo.MessageCreate, url string) {
+	if !security.ValidateURL(url) {
+		s.ChannelMessageSend(m.ChannelID, "Invalid URL provided.")
+		return
+	}
+
+	status, err := s.ChannelMessageSend(m.ChannelID, "Loading playlist...")
+	if err != nil {
+		return
+	}
+	update := func(content string) {
+		s.ChannelMessageEdit(m.ChannelID, status.ID, content)
+	}
+
+	entries, err := b.Downloader.GetPlaylist(url, b.Config.MaxPlaylistSize)
+	if err != nil {
+		update(fmt.Sprintf("Error loading playlist: %v", err))
+		return
+	}
+
+	if len(entries) == 0 {
+		update("Playlist is empty.")
+		return
+	}
+
+	player := b.MusicPlayers.Get(m.GuildID)
+
+	added, failed := 0, 0
+	for i, entry := range entries {
+		if i%5 == 0 {
+			update(fmt.Sprintf("Resolving playlist... %d/%d", i, len(entries)))
+		}
+
+		// Stop importing if the player was stopped in the meantime
+		if current, ok := b.MusicPlayers.Lookup(m.GuildID); !ok || current != player {
+			update(fmt.Sprintf("Playlist import stopped after %d tracks.", added))
+			return
+		}
+
+		track, err := b.resolveTrack(entry.URL)
+		if err != nil {
+			failed++
+			continue
+		}
+		track.Requester = m.Author.ID
+		track.ChannelID = m.ChannelID
+
+		if _, err := b.queueTrack(s, m.GuildID, m.Author.ID, track); err != nil {
+			update(fmt.Sprintf("Playlist import stopped after %d tracks: %v", added, err))
+			return
+		}
+		added++
+	}
+
+	summary := fmt.Sprintf("Added %d tracks from the playlist.", added)
+	if failed > 0 {
+		summary += fmt.Sprintf(" %d could not be added.", failed)
+	}
+	if b.Config.MaxPlaylistSize > 0 && len(entries) >= b.Config.MaxPlaylistSize {
+		summary += fmt.Sprintf(" Only the first %d entries were imported.", b.Config.MaxPlaylistSize)
+	}
+	update(summary)
+}
+
+// queueAndReply queues track for the user and reports the result in
+// channelID. Starting playback is announced by handleMusicEvent instead.
+func (b *Bot) queueAndReply(s *discordgo.Session, guildID, channelID, userID string, track *music.Track) {
+	started, err := b.queueTrack(s, guildID, userID, track)
+	if err != nil {
+		s.ChannelMessageSend(channelID, fmt.Sprintf("Error adding track: %v", err))
+		return
+	}
+
+	if !started {
+		length := music.FormatDuration(track.Duration)
+		if track.Live {
+			length = "live"
+		}
+		s.ChannelMessageSend(channelID, fmt.Sprintf("Added to queue: **%s** (%s)", track.Title, length))
+	}
+}
+
+// queueTrack joins the user's voice channel and queues track on the guild's
+// player, starting playback if nothing is playing. It reports whether the
+// track started right away.
+func (b *Bot) queueTrack(s *discordgo.Session, guildID, userID string, track *music.Track) (bool, error) {
+	return b.enqueue(s, guildID, userID, track, false)
+}
+
+// queueTrackNext is like queueTrack, but puts track at the front of the queue.
+func (b *Bot) queueTrackNext(s *discordgo.Session, guildID, userID string, track *music.Track) (bool, error) {
+	return b.enqueue(s, guildID, userID, track, true)
+}
+
+func (b *Bot) enqueue(s *discordgo.Session, guildID, userID string, track *music.Track, next bool) (bool, error) {
+	channelID, err := b.userVoiceChannel(s, guildID, userID)
+	if err != nil {
+		return false, fmt.Errorf("you need to be in a voice channel to play music")
+	}
+
+	player := b.MusicPlayers.Get(guildID)
+	if err := player.ConnectToVoice(guildID, channelID); err != nil {
+		return false, fmt.Errorf("error joining voice channel: %w", err)
+	}
+
+	if next {
+		player.AddNext(track)
+	} else {
+		player.AddToQueue(track)
+	}
+
+	if !player.IsPlaying() && player.GetCurrentTrack() == nil {
+		player.Play()
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (b *Bot) handleSearchMusicCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Please provide a song to search for.")
+		return
+	}
+
+	query := strings.Join(args, " ")
+	s.ChannelTyping(m.ChannelID)
+
+	results, err := b.Downloader.Search(query, 5)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error searching: %v", err))
+		return
+	}
+
+	if len(results) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "No results found.")
+		return
+	}
+
+	content := fmt.Sprintf("Results for **%s**:\n", query)
+	buttons := make([]discordgo.MessageComponent, 0, len(results))
+	for i, result := range results {
+		duration := time.Duration(result.Duration) * time.Second
+		content += fmt.Sprintf("%d. %s - %s (%s)\n", i+1, result.Title, result.Uploader, music.FormatDuration(duration))
+		buttons = append(buttons, discordgo.Button{
+			Label:    fmt.Sprintf("%d", i+1),
+			Style:    discordgo.PrimaryButton,
+			CustomID: fmt.Sprintf("music_search:%d", i),
+		})
+	}
+
+	msg, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:    content,
+		Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}},
+	})
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Forget searches nobody picked from
+	for id, search := range b.MusicSearches {
+		if time.Since(search.Created) > 10*time.Minute {
+			delete(b.MusicSearches, id)
+		}
+	}
+
+	b.MusicSearches[msg.ID] = &MusicSearch{
+		UserID:  m.Author.ID,
+		Results: results,
+		Created: time.Now(),
+	}
+}
+
+func (b *Bot) handleMusicSearchPick(s *discordgo.Session, i *discordgo.InteractionCreate, choice string) {
+	if i.Member == nil || i.Message == nil {
+		return
+	}
+	userID := i.Member.User.ID
+
+	var index int
+	if _, err := fmt.Sscanf(choice, "%d", &index); err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	search, ok := b.MusicSearches[i.Message.ID]
+	if ok && search.UserID == userID {
+		delete(b.MusicSearches, i.Message.ID)
+	}
+	b.mu.Unlock()
+
+	if !ok || index < 0 || index >= len(search.Results) {
+		respondEphemeral(s, i, "This search has expired.")
+		return
+	}
+
+	if search.UserID != userID {
+		respondEphemeral(s, i, "Only the person who searched can pick a result.")
+		return
+	}
+
+	result := search.Results[index]
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    fmt.Sprintf("Selected: **%s**", result.Title),
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+
+	track, err := b.resolveTrack(result.URL)
+	if err != nil {
+		s.ChannelMessageSend(i.ChannelID, fmt.Sprintf("Error adding track: %v", err))
+		return
+	}
+	track.Requester = userID
+	track.ChannelID = i.ChannelID
+
+	b.queueAndReply(s, i.GuildID, i.ChannelID, userID, track)
+}
+
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// userVoiceChannel returns the voice channel the user is currently in
+func (b *Bot) userVoiceChannel(s *discordgo.Session, guildID, userID string) (string, error) {
+	vs, err := s.State.VoiceState(guildID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if vs.ChannelID == "" {
+		return "", fmt.Errorf("user is not in a voice channel")
+	}
+
+	return vs.ChannelID, nil
+}
+
+// handleMusicEvent reports playback progress to the channel the track
+// was requested from
+func (b *Bot) handleMusicEvent(guildID string, event music.Event) {
+	if event.Track == nil || event.Track.ChannelID == "" {
+		return
+	}
+
+	channelID := event.Track.ChannelID
+
+	switch event.Type {
+	case music.EventTrackStarted:
+		message := fmt.Sprintf("Now playing: **%s**", event.Track.Title)
+		if event.Track.Requester != "" {
+			message += fmt.Sprintf(" (requested by <@%s>)", event.Track.Requester)
+		} else if event.Track.Autoplay {
+			message += " (autoplay)"
+		}
+		b.Session.ChannelMessageSend(channelID, message)
+	case music.EventSegmentSkipped:
+		// Trimmed silence isn't worth a message
+		if event.Segment != nil && event.Segment.Category != "silence" {
+			b.Session.ChannelMessageSend(channelID, fmt.Sprintf("Skipped %s (%s).",
+				segmentLabel(event.Segment.Category), music.FormatDuration(event.Segment.End-event.Segment.Start)))
+		}
+	case music.EventQueueEmpty:
+		b.Session.ChannelMessageSend(channelID, "Queue finished.")
+	case music.EventError:
+		b.Session.ChannelMessageSend(channelID, fmt.Sprintf("Error playing %s: %v", event.Track.Title, event.Err))
+	}
+}
+
+// restoreMusic brings back a guild's queue saved before a restart, as long
+// as someone is still listening in its voice channel.
+func (b *Bot) restoreMusic(s *discordgo.Session, guild *discordgo.Guild, state music.PlayerState) {
+	if state.Empty() || state.VoiceChannelID == "" || listenerCount(s, guild, state.VoiceChannelID) == 0 {
+		b.MusicState.Delete(guild.ID)
+		return
+	}
+
+	player := b.MusicPlayers.Restore(guild.ID, state)
+	if err := player.ConnectToVoice(guild.ID, state.VoiceChannelID); err != nil {
+		log.Printf("Failed to rejoin voice in guild %s: %v", guild.ID, err)
+		b.MusicPlayers.Remove(guild.ID)
+		return
+	}
+
+	// Nothing was current, so start the queue; handleMusicEvent announces it
+	if state.Current == nil {
+		player.Play()
+		return
+	}
+
+	if state.Current.ChannelID == "" {
+		return
+	}
+
+	message := fmt.Sprintf("Restored the music queue after a restart: **%s** and %d more in the queue.", state.Current.Title, len(state.Queue))
+	if state.Paused {
+		message += " Playback is paused, use /resume to continue."
+	}
+	s.ChannelMessageSend(state.Current.ChannelID, message)
+}
+
+// updateMusicListeners pauses the guild's player when its voice channel
+// empties and resumes it when someone comes back. A player whose bot was
+// disconnected by someone else is removed.
+func (b *Bot) updateMusicListeners(s *discordgo.Session, vs *discordgo.VoiceStateUpdate) {
+	player, ok := b.MusicPlayers.Lookup(vs.GuildID)
+	if !ok || !player.IsConnectedToVoice() {
+		return
+	}
+
+	if vs.UserID == s.State.User.ID {
+		if vs.ChannelID == "" {
+			b.MusicPlayers.Remove(vs.GuildID)
+			return
+		}
+
+		// Count listeners in the channel the bot was dragged to
+		player.VoiceChannelMoved(vs.ChannelID)
+	}
+
+	guild, err := s.State.Guild(vs.GuildID)
+	if err != nil {
+		return
+	}
+
+	b.MusicPlayers.ListenersChanged(vs.GuildID, listenerCount(s, guild, player.GetVoiceChannelID()))
+}
+
+// listenerCount returns how many users other than bots are in a voice channel
+func listenerCount(s *discordgo.Session, guild *discordgo.Guild, channelID string) int {
+	count := 0
+	for _, vs := range guild.VoiceStates {
+		if vs.ChannelID != channelID || vs.UserID == s.State.User.ID {
+			continue
+		}
+		if vs.Member != nil && vs.Member.User != nil && vs.Member.User.Bot {
+			continue
+		}
+		count++
+	}
+
+	return count
+}
+
+// recommendTracks finds tracks similar to seed for autoplay: YouTube's mix
+// for YouTube tracks, otherwise songs the AI suggests.
+func (b *Bot) recommendTracks(seed *music.Track, limit int) ([]*music.Track, error) {
+	var entries []ytdlp.Entry
+	var err error
+
+	if seed.ID != "" && ytdlp.IsYouTubeURL(seed.URL) {
+		// The mix starts with the seed itself
+		entries, err = b.Downloader.GetMix(seed.ID, limit+1)
+	}
+
+	if len(entries) == 0 {
+		entries, err = b.suggestSimilar(seed, limit)
+	}
+
+	maxLength := time.Duration(b.Config.MaxTrackLength) * time.Minute
+
+	var tracks []*music.Track
+	for _, entry := range entries {
+		duration := time.Duration(entry.Duration * float64(time.Second))
+		if entry.ID == seed.ID || (maxLength > 0 && duration > maxLength) {
+			continue
+		}
+
+		tracks = append(tracks, &music.Track{
+			ID:       entry.ID,
+			Title:    entry.Title,
+			URL:      entry.URL,
+			Duration: duration,
+			Uploader: entry.Uploader,
+		})
+	}
+
+	if len(tracks) == 0 && err != nil {
+		return nil, err
+	}
+
+	return tracks, nil
+}
+
+// suggestSimilar asks the AI for songs like seed and looks each one up
+func (b *Bot) suggestSimilar(seed *music.Track, limit int) ([]ytdlp.Entry, error) {
+	if limit > 5 {
+		limit = 5
+	}
+
+	prompt := fmt.Sprintf("Suggest %d songs similar to \"%s\"", limit, seed.Title)
+	if seed.Uploader != "" {
+		prompt += fmt.Sprintf(" by %s", seed.Uploader)
+	}
+	prompt += ". Reply with one song per line as \"Artist - Title\" and nothing else."
+
+	messages := []openrouter.Message{
+		{Role: "user", Content: prompt},
+	}
+
+	response, err := b.OpenRouter.ChatCompletion("openrouter/sonoma-dusk-alpha", messages)
+	if err != nil {
+		return nil, fmt.Errorf("error asking AI for similar songs: %w", err)
+	}
+
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("AI suggested no songs")
+	}
+
+	var entries []ytdlp.Entry
+	for _, line := range strings.Split(response.Choices[0].Message.Content, "\n") {
+		// Drop list markers such as "1." or "-"
+		query := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "0123456789.-*) "))
+		if query == "" {
+			continue
+		}
+
+		results, err := b.Downloader.Search(query, 1)
+		if err != nil || len(results) == 0 {
+			continue
+		}
+		entries = append(entries, results[0])
+
+		if len(entries) >= limit {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// guildFromChannel returns the guild a channel belongs to, or "" for DMs
+func (b *Bot) guildFromChannel(channelID string) string {
+	if channelID == "" {
+		return ""
+	}
+
+	channel, err := b.Session.State.Channel(channelID)
+	if err != nil {
+		channel, err = b.Session.Channel(channelID)
+		if err != nil {
+			return ""
+		}
+	}
+
+	return channel.GuildID
+}
+
+// activePlayer returns the guild's music player, telling the user when
+// nothing has been played in this server yet.
+func (b *Bot) activePlayer(s *discordgo.Session, m *discordgo.MessageCreate) (*music.Player, bool) {
+	player, ok := b.MusicPlayers.Lookup(m.GuildID)
+	if !ok {
+		s.ChannelMessageSend(m.ChannelID, "Nothing is playing.")
+		return nil, false
+	}
+
+	return player, true
+}
+
+func (b *Bot) handlePauseCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+	player, ok := b.activePlayer(s, m)
+	if !ok {
+		return
+	}
+
+	player.Pause()
+	s.ChannelMessageSend(m.ChannelID, "Playback paused.")
+}
+
+func (b *Bot) handleResumeCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+	player, ok := b.activePlayer(s, m)
+	if !ok {
+		return
+	}
+
+	player.Resume()
+	s.ChannelMessageSend(m.ChannelID, "Playback resumed.")
+}
+
+func (b *Bot) handleSkipCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+	player, ok := b.activePlayer(s, m)
+	if !ok {
+		return
+	}
+
+	if !b.isDJ(s, m) {
+		b.voteSkip(s, m, player)
+		return
+	}
+
+	if err := player.Skip(); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Skipped the last track.")
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, "Skipped to next track.")
+}
+
+// voteSkip counts the author's skip as a vote and skips once enough of
+// the listeners in the player's voice channel agree.
+func (b *Bot) voteSkip(s *discordgo.Session, m *discordgo.MessageCreate, player *music.Player) {
+	channelID, err := b.userVoiceChannel(s, m.GuildID, m.Author.ID)
+	if err != nil || channelID != player.GetVoiceChannelID() {
+		s.ChannelMessageSend(m.ChannelID, "You need to be in the bot's voice channel to vote to skip.")
+		return
+	}
+
+	guild, err := s.State.Guild(m.GuildID)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error counting listeners: %v", err))
+		return
+	}
+
+	needed := music.RequiredVotes(listenerCount(s, guild, channelID), b.Config.SkipVoteRatio)
+	votes, skipped, err := player.VoteSkip(m.Author.ID, needed)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Nothing is playing.")
+		return
+	}
+
+	if skipped {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Vote passed (%d/%d), skipping.", votes, needed))
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Voted to skip: %d/%d votes.", votes, needed))
+}
+
+// isAdmin reports whether the author can manage the server
+func (b *Bot) isAdmin(s *discordgo.Session, m *discordgo.MessageCreate) bool {
+	perms, err := s.State.MessagePermissions(m.Message)
+	return err == nil && perms&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0
+}
+
+// isDJ reports whether the author may control playback without a vote:
+// members with the configured DJ role, or who can manage the server.
+func (b *Bot) isDJ(s *discordgo.Session, m *discordgo.MessageCreate) bool {
+	if b.isAdmin(s, m) {
+		return true
+	}
+
+	if b.Config.DJRole == "" || m.Member == nil {
+		return false
+	}
+
+	for _, roleID := range m.Member.Roles {
+		if roleID == b.Config.DJRole {
+			return true
+		}
+
+		role, err := s.State.Role(m.GuildID, roleID)
+		if err == nil && strings.EqualFold(role.Name, b.Config.DJRole) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requireDJ tells the author off and returns false unless they are a DJ
+func (b *Bot) requireDJ(s *discordgo.Session, m *discordgo.MessageCreate, action string) bool {
+	if b.isDJ(s, m) {
+		return true
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Only DJs can %s.", action))
+	return false
+}
+
+func (b *Bot) handleStopCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if !b.requireDJ(s, m, "stop playback") {
+		return
+	}
+
+	b.MusicPlayers.Remove(m.GuildID)
+	s.ChannelMessageSend(m.ChannelID, "Playback stopped and queue cleared.")
+}
+
+// queuePageSize is how many tracks each page of /queue shows
+const queuePageSize = 10
+
+func (b *Bot) handleQueueCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	player, ok := b.MusicPlayers.Lookup(m.GuildID)
+	if !ok || (len(player.GetQueue()) == 0 && player.GetCurrentTrack() == nil) {
+		s.ChannelMessageSend(m.ChannelID, "Queue is empty.")
+		return
+	}
+
+	page := 0
+	if len(args) > 0 {
+		if _, err := fmt.Sscanf(args[0], "%d", &page); err == nil {
+			page--
+		}
+	}
+
+	embed, components := queueMessage(player, page)
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	})
+}
+
+// handleQueuePage flips a /queue message to another page
+func (b *Bot) handleQueuePage(s *discordgo.Session, i *discordgo.InteractionCreate, choice string) {
+	var page int
+	if _, err := fmt.Sscanf(choice, "%d", &page); err != nil {
+		return
+	}
+
+	player, ok := b.MusicPlayers.Lookup(i.GuildID)
+	if !ok {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    "Queue is empty.",
+				Embeds:     []*discordgo.MessageEmbed{},
+				Components: []discordgo.MessageComponent{},
+			},
+		})
+		return
+	}
+
+	embed, components := queueMessage(player, page)
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+}
+
+// queueMessage renders one page of the player's queue, with buttons to
+// flip to the pages around it. Out of range pages show the closest one.
+func queueMessage(player *music.Player, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	queue := player.GetQueue()
+
+	pages := (len(queue) + queuePageSize - 1) / queuePageSize
+	if pages == 0 {
+		pages = 1
+	}
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: "Music Queue",
+		Color: 0x1DB954,
+	}
+
+	if current := player.GetCurrentTrack(); current != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Now playing", Value: queueLine(current)})
+	}
+
+	start := page * queuePageSize
+	end := start + queuePageSize
+	if end > len(queue) {
+		end = len(queue)
+	}
+
+	description := ""
+	for i, track := range queue[start:end] {
+		description += fmt.Sprintf("`%d.` %s\n", start+i+1, queueLine(track))
+	}
+	if description == "" {
+		description = "Nothing else is queued."
+	}
+	embed.Description = description
+
+	// Live tracks and tracks of unknown length make the total a minimum
+	var total time.Duration
+	unknown := ""
+	for _, track := range queue {
+		if track.Live || track.Duration <= 0 {
+			unknown = "+"
+		}
+		total += track.Duration
+	}
+
+	shuffle := "off"
+	if player.IsShuffled() {
+		shuffle = "on"
+	}
+	embed.Footer = &discordgo.MessageEmbedFooter{
+		Text: fmt.Sprintf("Page %d/%d | %d tracks | Total: %s%s | Loop: %s | Shuffle: %s",
+			page+1, pages, len(queue), music.FormatDuration(total), unknown, player.GetLoopMode(), shuffle),
+	}
+
+	if pages == 1 {
+		return embed, []discordgo.MessageComponent{}
+	}
+
+	return embed, []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Previous",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("music_queue:%d", page-1),
+				Disabled: page == 0,
+			},
+			discordgo.Button{
+				Label:    "Next",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("music_queue:%d", page+1),
+				Disabled: page == pages-1,
+			},
+		}},
+	}
+}
+
+// queueLine describes a track in one line: its title, length and requester
+func queueLine(track *music.Track) string {
+	title := track.Title
+	if len([]rune(title)) > 60 {
+		title = string([]rune(title)[:57]) + "..."
+	}
+	title = strings.NewReplacer("[", "(", "]", ")").Replace(title)
+
+	length := music.FormatDuration(track.Duration)
+	if track.Live {
+		length = "live"
+	}
+
+	line := fmt.Sprintf("[%s](%s) `%s`", title, track.URL, length)
+	if track.Requester != "" {
+		line += fmt.Sprintf(" - <@%s>", track.Requester)
+	} else if track.Autoplay {
+		line += " - autoplay"
+	}
+	return line
+}
+
+// queuePosition parses a 1-based queue position given to a command
+func queuePosition(arg string, player *music.Player) (int, error) {
+	var position int
+	if _, err := fmt.Sscanf(arg, "%d", &position); err != nil {
+		return 0, fmt.Errorf("invalid position: %s", arg)
+	}
+
+	if length := player.GetQueueLength(); position < 1 || position > length {
+		return 0, fmt.Errorf("position must be between 1 and %d", length)
+	}
+
+	return position - 1, nil
+}
+
+func (b *Bot) handleMoveCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	player, ok := b.activePlayer(s, m)
+	if !ok || !b.requireDJ(s, m, "move tracks") {
+		return
+	}
+
+	if len(args) < 2 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: /move <from> <to>")
+		return
+	}
+
+	from, err := queuePosition(args[0], player)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error moving track: %v", err))
+		return
+	}
+	to, err := queuePosition(args[1], player)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error moving track: %v", err))
+		return
+	}
+
+	track, err := player.MoveInQueue(from, to)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error moving track: %v", err))
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Moved **%s** to position %d.", track.Title, to+1))
+}
+
+// handleRemoveCommand removes a track from the queue. Anyone may remove
+// their own tracks, only DJs can remove other people's.
+func (b *Bot) handleRemoveCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	player, ok := b.activePlayer(s, m)
+	if !ok {
+		return
+	}
+
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: /remove <position>")
+		return
+	}
+
+	index, err := queuePosition(args[0], player)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error removing track: %v", err))
+		return
+	}
+
+	// The check runs under the player's lock, so it can't send messages
+	dj := b.isDJ(s, m)
+	track, err := player.RemoveIf(index, func(track *music.Track) bool {
+		return dj || track.Requester == m.Author.ID
+	})
+	if errors.Is(err, music.ErrNotAllowed) {
+		s.ChannelMessageSend(m.ChannelID, "Only DJs can remove other people's tracks.")
+		return
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error removing track: %v", err))
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Removed **%s** from the queue.", track.Title))
+}
+
+func (b *Bot) handleClearCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+	player, ok := b.activePlayer(s, m)
+	if !ok || !b.requireDJ(s, m, "clear the queue") {
+		return
+	}
+
+	player.ClearQueue()
+	s.ChannelMessageSend(m.ChannelID, "Queue cleared. The current track keeps playing.")
+}
+
+func (b *Bot) handleSkipToCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	player, ok := b.activePlayer(s, m)
+	if !ok || !b.requireDJ(s, m, "skip to a track") {
+		return
+	}
+
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: /skipto <position>")
+		return
+	}
+
+	index, err := queuePosition(args[0], player)
+	if err == nil {
+		err = player.SkipTo(index)
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error skipping: %v", err))
+	}
+}
+
+// handlePlayNextCommand queues a track to play right after the current one.
+func (b *Bot) handlePlayNextCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Please provide a URL or song name to play.")
+		return
+	}
+
+	if _, err := b.userVoiceChannel(s, m.GuildID, m.Author.ID); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "You need to be in a voice channel to play music.")
+		return
+	}
+
+	// Resolving can take a few seconds
+	s.ChannelTyping(m.ChannelID)
+
+	track, err := b.resolveQuery(strings.Join(args, " "))
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error adding track: %v", err))
+		return
+	}
+	track.Requester = m.Author.ID
+	track.ChannelID = m.ChannelID
+
+	started, err := b.queueTrackNext(s, m.GuildID, m.Author.ID, track)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error adding track: %v", err))
+		return
+	}
+
+	if !started {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("**%s** will play next (%s).", track.Title, music.FormatDuration(track.Duration)))
+	}
+}
+
+func (b *Bot) handleVolumeCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		player, ok := b.activePlayer(s, m)
+		if !ok {
+			return
+		}
+
+		volume := player.GetVolume() * 100
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Current volume: %.0f%%", volume))
+		return
+	}
+
+	if !b.requireDJ(s, m, "change the volume") {
+		return
+	}
+
+	player, ok := b.activePlayer(s, m)
+	if !ok {
+		return
+	}
+
+	// Parse volume level
+	var volume int
+	_, err := fmt.Sscanf(args[0], "%d", &volume)
+	if err != nil || volume < 0 || volume > 100 {
+		s.ChannelMessageSend(m.ChannelID, "Please provide a valid volume level between 0 and 100.")
+		return
+	}
+
+	if err := player.SetVolume(float64(volume) / 100.0); err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Volume set to %d%%, but the track could not be restarted: %v", volume, err))
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Volume set to %d%%", volume))
+}
+
+func (b *Bot) handleLoopCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	player, ok := b.activePlayer(s, m)
+	if !ok {
+		return
+	}
+
+	// Without an argument, cycle off -> track -> queue
+	mode := player.GetLoopMode().Next()
+	if len(args) > 0 {
+		var err error
+		mode, err = music.ParseLoopMode(args[0])
+		if err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Please choose a loop mode: off, track or queue.")
+			return
+		}
+	}
+
+	player.SetLoopMode(mode)
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Loop mode set to %s.", mode))
+}
+
+func (b *Bot) handleShuffleCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	player, ok := b.activePlayer(s, m)
+	if !ok {
+		return
+	}
+
+	if len(args) > 0 && strings.ToLower(args[0]) == "off" {
+		if err := player.Unshuffle(); err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Queue is not shuffled.")
+			return
+		}
+		s.ChannelMessageSend(m.ChannelID, "Queue restored to its original order.")
+		return
+	}
+
+	if player.GetQueueLength() < 2 {
+		s.ChannelMessageSend(m.ChannelID, "Not enough tracks in the queue to shuffle.")
+		return
+	}
+
+	player.Shuffle()
+	s.ChannelMessageSend(m.ChannelID, "Queue shuffled. Use /shuffle off to undo.")
+}
+
+func (b *Bot) handleSeekCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Please provide a position to seek to, e.g. /seek 1:30")
+		return
+	}
+
+	position, err := music.ParseTimestamp(args[0])
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Invalid position. Use mm:ss, e.g. /seek 1:30")
+		return
+	}
+
+	player, ok := b.activePlayer(s, m)
+	if !ok {
+		return
+	}
+
+	if err := player.Seek(position); err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Cannot seek: %v", err))
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Seeked to %s.", music.FormatDuration(position)))
+}
+
+func (b *Bot) handleRadioCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	stations := b.Config.Stations()
+
+	if len(args) == 0 || strings.ToLower(args[0]) == "list" {
+		if len(stations) == 0 {
+			s.ChannelMessageSend(m.ChannelID, "No radio stations configured. Use /radio <url> to play a stream.")
+			return
+		}
+
+		message := "Radio stations:\n"
+		for _, station := range stations {
+			message += fmt.Sprintf("- %s\n", station.Name)
+		}
+		message += "\nUse /radio <name> to tune in."
+
+		s.ChannelMessageSend(m.ChannelID, message)
+		return
+	}
+
+	if _, err := b.userVoiceChannel(s, m.GuildID, m.Author.ID); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "You need to be in a voice channel to play music.")
+		return
+	}
+
+	name := strings.ToLower(args[0])
+	track := &music.Track{
+		Live:      true,
+		Requester: m.Author.ID,
+		ChannelID: m.ChannelID,
+	}
+
+	for _, station := range stations {
+		if station.Name == name {
+			track.Title = "📻 " + station.Name
+			track.URL = station.URL
+			break
+		}
+	}
+
+	if track.URL == "" {
+		if !isURL(args[0]) {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Unknown station: %s. Use /radio list to see the available stations.", args[0]))
+			return
+		}
+		if !security.ValidateURL(args[0]) {
+			s.ChannelMessageSend(m.ChannelID, "Invalid URL provided.")
+			return
+		}
+		track.Title = "📻 " + args[0]
+		track.URL = args[0]
+	}
+
+	b.queueAndReply(s, m.GuildID, m.ChannelID, m.Author.ID, track)
+}
+
+func (b *Bot) handleFilterCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	player, ok := b.activePlayer(s, m)
+	if !ok {
+		return
+	}
+
+	filters := player.GetFilters()
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Active filters: %s\nPresets: %s\nUse /filter <preset>, /filter speed <0.5-2>, /filter pitch <0.5-2>, /filter eq <band 1-10> <gain dB> or /filter off.",
+			filters, strings.Join(music.Presets(), ", ")))
+		return
+	}
+
+	if !b.requireDJ(s, m, "change filters") {
+		return
+	}
+
+	var err error
+	switch name := strings.ToLower(args[0]); name {
+	case "off", "clear", "reset":
+		filters = music.FilterSet{}
+	case "speed", "pitch":
+		var value float64
+		if len(args) < 2 {
+			err = fmt.Errorf("please provide a value, e.g. /filter %s 1.25", name)
+		} else if _, err = fmt.Sscanf(args[1], "%g", &value); err != nil {
+			err = fmt.Errorf("invalid %s: %s", name, args[1])
+		} else if name == "speed" {
+			filters, err = filters.SetSpeed(value)
+		} else {
+			filters, err = filters.SetPitch(value)
+		}
+	case "eq", "equalizer":
+		var band int
+		var gain float64
+		if len(args) == 2 && strings.ToLower(args[1]) == "flat" {
+			filters.Equalizer = [10]float64{}
+		} else if len(args) < 3 {
+			err = fmt.Errorf("please provide a band and gain, e.g. /filter eq 1 6")
+		} else if _, err = fmt.Sscanf(args[1]+" "+args[2], "%d %g", &band, &gain); err != nil {
+			err = fmt.Errorf("invalid band or gain")
+		} else {
+			filters, err = filters.SetBand(band, gain)
+		}
+	default:
+		filters, _, err = filters.TogglePreset(name)
+	}
+
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error setting filter: %v", err))
+		return
+	}
+
+	if err := player.SetFilters(filters); err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Active filters: %s, but the track could not be restarted: %v", filters, err))
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Active filters: %s", filters))
+}
+
+func (b *Bot) handleNormalizeCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		state := "off"
+		if b.MusicPlayers.Settings(m.GuildID).Normalize {
+			state = "on"
+		}
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Loudness normalization is %s. Use /normalize on or /normalize off to change it.", state))
+		return
+	}
+
+	if !b.requireDJ(s, m, "change loudness normalization") {
+		return
+	}
+
+	var normalize bool
+	switch strings.ToLower(args[0]) {
+	case "on":
+		normalize = true
+	case "off":
+		normalize = false
+	default:
+		s.ChannelMessageSend(m.ChannelID, "Please choose on or off.")
+		return
+	}
+
+	state := "disabled"
+	if normalize {
+		state = "enabled"
+	}
+	err := b.MusicPlayers.UpdateSettings(m.GuildID, func(settings *music.GuildSettings) {
+		settings.Normalize = normalize
+	})
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Loudness normalization %s, but %v", state, err))
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Loudness normalization %s.", state))
+}
+
+func (b *Bot) handleCrossfadeCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Transition between tracks: %s. Use /crossfade <seconds>, /crossfade gapless or /crossfade off to change it.", b.MusicPlayers.Settings(m.GuildID).Transition))
+		return
+	}
+
+	if !b.requireDJ(s, m, "change the crossfade") {
+		return
+	}
+
+	transition := music.Transition{Enabled: true}
+	switch arg := strings.ToLower(args[0]); arg {
+	case "off":
+		transition.Enabled = false
+	case "gapless", "0":
+	default:
+		var seconds int
+		if _, err := fmt.Sscanf(arg, "%d", &seconds); err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Please provide the crossfade in seconds, gapless or off.")
+			return
+		}
+		transition.Crossfade = time.Duration(seconds) * time.Second
+	}
+
+	err := b.MusicPlayers.UpdateSettings(m.GuildID, func(settings *music.GuildSettings) {
+		settings.Transition = transition
+	})
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error setting crossfade: %v", err))
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Transition between tracks set to %s.", transition))
+}
+
+func (b *Bot) handleSponsorBlockCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		state := "off"
+		if b.MusicPlayers.Settings(m.GuildID).SkipSegments {
+			state = "on"
+		}
+		message := fmt.Sprintf("Skipping sponsor segments and silence is %s. Use /sponsorblock on or /sponsorblock off to change it.", state)
+
+		var segments []music.Segment
+		if player, ok := b.MusicPlayers.Lookup(m.GuildID); ok {
+			segments = player.GetSegments()
+		}
+		if len(segments) > 0 {
+			message += "\nSegments in the current track:"
+			for _, segment := range segments {
+				message += fmt.Sprintf("\n%s - %s: %s", music.FormatDuration(segment.Start), music.FormatDuration(segment.End), segmentLabel(segment.Category))
+			}
+		}
+
+		s.ChannelMessageSend(m.ChannelID, message)
+		return
+	}
+
+	if !b.requireDJ(s, m, "change segment skipping") {
+		return
+	}
+
+	var skip bool
+	switch strings.ToLower(args[0]) {
+	case "on":
+		skip = true
+	case "off":
+		skip = false
+	default:
+		s.ChannelMessageSend(m.ChannelID, "Please choose on or off.")
+		return
+	}
+
+	err := b.MusicPlayers.UpdateSettings(m.GuildID, func(settings *music.GuildSettings) {
+		settings.SkipSegments = skip
+	})
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error changing segment skipping: %v", err))
+		return
+	}
+
+	if skip {
+		s.ChannelMessageSend(m.ChannelID, "Sponsor segments and silence will be skipped.")
+	} else {
+		s.ChannelMessageSend(m.ChannelID, "Sponsor segments and silence will be played.")
+	}
+}
+
+// segmentLabel describes a SponsorBlock category in words
+func segmentLabel(category string) string {
+	switch category {
+	case "selfpromo":
+		return "self-promotion"
+	case "interaction":
+		return "interaction reminder"
+	case "music_offtopic":
+		return "non-music section"
+	case "":
+		return "segment"
+	}
+	return category
+}
+
+func (b *Bot) handleAutoplayCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	player, ok := b.activePlayer(s, m)
+	if !ok {
+		return
+	}
+
+	// Without an argument, toggle
+	enabled := !player.IsAutoplay()
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "on":
+			enabled = true
+		case "off":
+			enabled = false
+		default:
+			s.ChannelMessageSend(m.ChannelID, "Please choose on or off.")
+			return
+		}
+	}
+
+	player.SetAutoplay(enabled)
+	if enabled {
+		s.ChannelMessageSend(m.ChannelID, "Autoplay enabled. Related tracks will play when the queue runs out.")
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, "Autoplay disabled.")
+}
+
+// historyPageSize is how many tracks /history and /history top list
+const historyPageSize = 10
+
+// maxPlaylistUpload is the largest playlist file /playlist import accepts
+const maxPlaylistUpload = 1 << 20
+
+// handlePlaylistCommand manages saved playlists. Playlists are personal
+// unless "server" follows the action, e.g. /playlist save server party.
+func (b *Bot) handlePlaylistCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: /playlist <save|load|list|delete|add|remove|export|import> [server] <name>")
+		return
+	}
+
+	action := strings.ToLower(args[0])
+	args = args[1:]
+
+	scope := music.ScopeUser
+	shared := false
+	if len(args) > 0 && strings.ToLower(args[0]) == "server" {
+		scope = music.ScopeServer
+		shared = true
+		args = args[1:]
+	}
+
+	switch action {
+	case "list":
+		b.listPlaylists(s, m, shared)
+		return
+	case "import":
+		b.importPlaylistFile(s, m, scope, args)
+		return
+	}
+
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Please provide a playlist name.")
+		return
+	}
+	name := args[0]
+	args = args[1:]
+
+	switch action {
+	case "save":
+		b.savePlaylist(s, m, scope, name, args)
+	case "load", "play":
+		b.loadPlaylist(s, m, shared, name)
+	case "delete":
+		b.deletePlaylist(s, m, scope, name)
+	case "add":
+		b.addToPlaylist(s, m, scope, name, args)
+	case "remove":
+		b.removeFromPlaylist(s, m, scope, name, args)
+	case "export":
+		b.exportPlaylist(s, m, shared, name, args)
+	default:
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Unknown playlist action: %s.", action))
+	}
+}
+
+// playlistOwner is who owns m's playlists of the given scope
+func playlistOwner(m *discordgo.MessageCreate, scope music.PlaylistScope) string {
+	if scope == music.ScopeServer {
+		return m.GuildID
+	}
+	return m.Author.ID
+}
+
+// findPlaylist looks up a playlist for loading or exporting, falling back
+// to the server's playlists unless a scope was given.
+func (b *Bot) findPlaylist(m *discordgo.MessageCreate, shared bool, name string) (*music.Playlist, error) {
+	if !shared {
+		pl, err := b.Playlists.Get(music.ScopeUser, m.Author.ID, name)
+		if err != music.ErrPlaylistNotFound {
+			return pl, err
+		}
+	}
+
+	return b.Playlists.Get(music.ScopeServer, m.GuildID, name)
+}
+
+// editablePlaylist loads a playlist the user is about to change. Server
+// playlists can only be changed by whoever created them or by DJs.
+func (b *Bot) editablePlaylist(s *discordgo.Session, m *discordgo.MessageCreate, scope music.PlaylistScope, name string) (*music.Playlist, error) {
+	pl, err := b.Playlists.Get(scope, playlistOwner(m, scope), name)
+	if err != nil {
+		return nil, err
+	}
+
+	if scope == music.ScopeServer && pl.Creator != m.Author.ID && !b.isDJ(s, m) {
+		return nil, fmt.Errorf("only the creator of %s or DJs can change it", pl.Name)
+	}
+
+	return pl, nil
+}
+
+func (b *Bot) listPlaylists(s *discordgo.Session, m *discordgo.MessageCreate, shared bool) {
+	message := ""
+
+	if !shared {
+		personal, err := b.Playlists.List(music.ScopeUser, m.Author.ID)
+		if err != nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error listing playlists: %v", err))
+			return
+		}
+		message += formatPlaylists("Your playlists", personal)
+	}
+
+	server, err := b.Playlists.List(music.ScopeServer, m.GuildID)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error listing playlists: %v", err))
+		return
+	}
+	message += formatPlaylists("Server playlists", server)
+
+	s.ChannelMessageSend(m.ChannelID, message)
+}
+
+func formatPlaylists(heading string, playlists []*music.Playlist) string {
+	text := fmt.Sprintf("**%s:**\n", heading)
+	if len(playlists) == 0 {
+		return text + "None yet.\n"
+	}
+
+	for _, pl := range playlists {
+		text += fmt.Sprintf("- %s (%d tracks, %s)\n", pl.Name, len(pl.Tracks), music.FormatDuration(pl.Duration()))
+	}
+	return text
+}
+
+// savePlaylist saves the given URLs as a playlist, or the current track
+// and queue if there are none.
+func (b *Bot) savePlaylist(s *discordgo.Session, m *discordgo.MessageCreate, scope music.PlaylistScope, name string, urls []string) {
+	pl := &music.Playlist{Name: name, Scope: scope, Owner: playlistOwner(m, scope), Creator: m.Author.ID}
+
+	existing, err := b.editablePlaylist(s, m, scope, name)
+	switch {
+	case err == nil:
+		pl.Creator = existing.Creator
+	case err != music.ErrPlaylistNotFound:
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error saving playlist: %v", err))
+		return
+	}
+
+	var tracks []*music.Track
+	failed := 0
+
+	if len(urls) > 0 {
+		s.ChannelTyping(m.ChannelID)
+
+		for _, url := range urls {
+			if !isURL(url) {
+				failed++
+				continue
+			}
+			track, err := b.resolveQuery(url)
+			if err != nil {
+				failed++
+				continue
+			}
+			tracks = append(tracks, track)
+		}
+	} else if player, ok := b.MusicPlayers.Lookup(m.GuildID); ok {
+		if current := player.GetCurrentTrack(); current != nil {
+			tracks = append(tracks, current)
+		}
+		tracks = append(tracks, player.GetQueue()...)
+	}
+
+	if len(tracks) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Nothing to save. Queue some tracks or give /playlist save a list of URLs.")
+		return
+	}
+
+	if err := pl.Add(tracks...); err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error saving playlist: %v", err))
+		return
+	}
+	pl.Updated = time.Now()
+
+	if err := b.Playlists.Save(pl); err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error saving playlist: %v", err))
+		return
+	}
+
+	message := fmt.Sprintf("Saved playlist **%s** with %d tracks.", pl.Name, len(pl.Tracks))
+	if failed > 0 {
+		message += fmt.Sprintf(" %d could not be added.", failed)
+	}
+	s.ChannelMessageSend(m.ChannelID, message)
+}
+
+// loadPlaylist queues every track of a saved playlist.
+func (b *Bot) loadPlaylist(s *discordgo.Session, m *discordgo.MessageCreate, shared bool, name string) {
+	pl, err := b.findPlaylist(m, shared, name)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error loading playlist: %v", err))
+		return
+	}
+
+	if _, err := b.userVoiceChannel(s, m.GuildID, m.Author.ID); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "You need to be in a voice channel to play music.")
+		return
+	}
+
+	maxLength := time.Duration(b.Config.MaxTrackLength) * time.Minute
+
+	added, skipped := 0, 0
+	for _, saved := range pl.Tracks {
+		if maxLength > 0 && saved.Duration > maxLength {
+			skipped++
+			continue
+		}
+
+		track := *saved
+		track.Requester = m.Author.ID
+		track.ChannelID = m.ChannelID
+
+		if _, err := b.queueTrack(s, m.GuildID, m.Author.ID, &track); err != nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Playlist load stopped after %d tracks: %v", added, err))
+			return
+		}
+		added++
+	}
+
+	message := fmt.Sprintf("Added %d tracks from playlist **%s**.", added, pl.Name)
+	if skipped > 0 {
+		message += fmt.Sprintf(" %d were longer than the track length limit.", skipped)
+	}
+	s.ChannelMessageSend(m.ChannelID, message)
+}
+
+func (b *Bot) deletePlaylist(s *discordgo.Session, m *discordgo.MessageCreate, scope music.PlaylistScope, name string) {
+	pl, err := b.editablePlaylist(s, m, scope, name)
+	if err == nil {
+		err = b.Playlists.Delete(scope, pl.Owner, pl.Name)
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error deleting playlist: %v", err))
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Deleted playlist **%s**.", pl.Name))
+}
+
+// addToPlaylist appends a URL or search result to a playlist, creating
+// the playlist if it doesn't exist yet.
+func (b *Bot) addToPlaylist(s *discordgo.Session, m *discordgo.MessageCreate, scope music.PlaylistScope, name string, args []string) {
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Please provide a URL or song name to add.")
+		return
+	}
+
+	pl, err := b.editablePlaylist(s, m, scope, name)
+	if err == music.ErrPlaylistNotFound {
+		pl, err = &music.Playlist{Name: name, Scope: scope, Owner: playlistOwner(m, scope), Creator: m.Author.ID}, nil
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error adding to playlist: %v", err))
+		return
+	}
+
+	s.ChannelTyping(m.ChannelID)
+
+	track, err := b.resolveQuery(strings.Join(args, " "))
+	if err == nil {
+		err = pl.Add(track)
+	}
+	if err == nil {
+		pl.Updated = time.Now()
+		err = b.Playlists.Save(pl)
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error adding to playlist: %v", err))
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Added **%s** to playlist **%s** (%d tracks).", track.Title, pl.Name, len(pl.Tracks)))
+}
+
+func (b *Bot) removeFromPlaylist(s *discordgo.Session, m *discordgo.MessageCreate, scope music.PlaylistScope, name string, args []string) {
+	var index int
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Please provide the number of the track to remove.")
+		return
+	}
+	if _, err := fmt.Sscanf(args[0], "%d", &index); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Invalid track number.")
+		return
+	}
+
+	pl, err := b.editablePlaylist(s, m, scope, name)
+	var track *music.Track
+	if err == nil {
+		track, err = pl.Remove(index - 1)
+	}
+	if err == nil {
+		pl.Updated = time.Now()
+		err = b.Playlists.Save(pl)
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error removing from playlist: %v", err))
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Removed **%s** from playlist **%s**.", track.Title, pl.Name))
+}
+
+// exportPlaylist sends a playlist as a JSON or M3U file attachment.
+func (b *Bot) exportPlaylist(s *discordgo.Session, m *discordgo.MessageCreate, shared bool, name string, args []string) {
+	pl, err := b.findPlaylist(m, shared, name)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error exporting playlist: %v", err))
+		return
+	}
+
+	format := "json"
+	if len(args) > 0 {
+		format = strings.ToLower(args[0])
+	}
+
+	var data []byte
+	var contentType string
+	switch format {
+	case "json":
+		data, err = pl.ExportJSON()
+		contentType = "application/json"
+	case "m3u", "m3u8":
+		format = "m3u"
+		data = pl.ExportM3U()
+		contentType = "audio/x-mpegurl"
+	default:
+		s.ChannelMessageSend(m.ChannelID, "Please choose json or m3u.")
+		return
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error exporting playlist: %v", err))
+		return
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("Playlist **%s** (%d tracks):", pl.Name, len(pl.Tracks)),
+		Files: []*discordgo.File{{
+			Name:        pl.Name + "." + format,
+			ContentType: contentType,
+			Reader:      bytes.NewReader(data),
+		}},
+	})
+}
+
+// importPlaylistFile saves a JSON or M3U playlist attached to the message,
+// named after the optional argument or else the file.
+func (b *Bot) importPlaylistFile(s *discordgo.Session, m *discordgo.MessageCreate, scope music.PlaylistScope, args []string) {
+	if len(m.Attachments) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Please attach a JSON or M3U playlist file.")
+		return
+	}
+
+	attachment := m.Attachments[0]
+	if attachment.Size > maxPlaylistUpload {
+		s.ChannelMessageSend(m.ChannelID, "Playlist file is too large.")
+		return
+	}
+
+	data, err := fetchAttachment(attachment.URL)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error importing playlist: %v", err))
+		return
+	}
+
+	pl, err := music.ParsePlaylist(attachment.Filename, data, security.ValidateURL)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error importing playlist: %v", err))
+		return
+	}
+
+	if len(args) > 0 {
+		pl.Name = args[0]
+	}
+	pl.Scope = scope
+	pl.Owner = playlistOwner(m, scope)
+	pl.Creator = m.Author.ID
+	pl.Updated = time.Now()
+
+	if existing, err := b.editablePlaylist(s, m, scope, pl.Name); err == nil {
+		pl.Creator = existing.Creator
+	} else if err != music.ErrPlaylistNotFound {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error importing playlist: %v", err))
+		return
+	}
+
+	if err := b.Playlists.Save(pl); err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error importing playlist: %v", err))
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Imported playlist **%s** with %d tracks.", pl.Name, len(pl.Tracks)))
+}
+
+// fetchAttachment downloads a Discord attachment of at most maxPlaylistUpload bytes
+func fetchAttachment(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed with status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistUpload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPlaylistUpload {
+		return nil, fmt.Errorf("playlist file is too large")
+	}
+
+	return data, nil
+}
+
+func (b *Bot) handleHistoryCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) > 0 && strings.ToLower(args[0]) == "top" {
+		b.showTopTracks(s, m)
+		return
+	}
+
+	entries, err := b.History.Recent(m.GuildID, historyPageSize)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error reading history: %v", err))
+		return
+	}
+
+	if len(entries) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Nothing has been played yet.")
+		return
+	}
+
+	message := "Recently played:\n"
+	for i, entry := range entries {
+		message += fmt.Sprintf("%d. **%s**", i+1, entry.Track.Title)
+		if entry.Track.Requester != "" {
+			message += fmt.Sprintf(" - <@%s>", entry.Track.Requester)
+		} else {
+			message += " - autoplay"
+		}
+		message += fmt.Sprintf(" <t:%d:R>\n", entry.PlayedAt.Unix())
+	}
+	message += "\nUse /replay <number> to play one again, or /history top for this week's most played tracks."
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:         message,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+}
+
+// showTopTracks lists the server's most played tracks of the past week
+func (b *Bot) showTopTracks(s *discordgo.Session, m *discordgo.MessageCreate) {
+	top, err := b.History.Top(m.GuildID, time.Now().Add(-7*24*time.Hour), historyPageSize)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error reading history: %v", err))
+		return
+	}
+
+	if len(top) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Nothing has been played this week.")
+		return
+	}
+
+	message := "Top tracks this week:\n"
+	for i, stat := range top {
+		plays := "plays"
+		if stat.Plays == 1 {
+			plays = "play"
+		}
+		message += fmt.Sprintf("%d. **%s** (%d %s)\n", i+1, stat.Track.Title, stat.Plays, plays)
+	}
+
+	s.ChannelMessageSend(m.ChannelID, message)
+}
+
+// handleReplayCommand queues the nth most recently played track to play next.
+func (b *Bot) handleReplayCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	var n int
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Please provide the number of a track from /history.")
+		return
+	}
+	if _, err := fmt.Sscanf(args[0], "%d", &n); err != nil || n < 1 || n > historyPageSize {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Please provide a number between 1 and %d from /history.", historyPageSize))
+		return
+	}
+
+	entries, err := b.History.Recent(m.GuildID, n)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error reading history: %v", err))
+		return
+	}
+	if len(entries) < n {
+		s.ChannelMessageSend(m.ChannelID, "There is no such track in the history.")
+		return
+	}
+
+	track := b.replayTrack(m, entries[n-1])
+	started, err := b.queueTrackNext(s, m.GuildID, m.Author.ID, track)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error adding track: %v", err))
+		return
+	}
+
+	if !started {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("**%s** will play next.", track.Title))
+	}
+}
+
+// handleBackCommand goes back to the track played before the current one.
+// It plays right away for DJs and whoever requested the current track,
+// and plays next for everyone else.
+func (b *Bot) handleBackCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+	var current *music.Track
+	if player, ok := b.MusicPlayers.Lookup(m.GuildID); ok {
+		current = player.GetCurrentTrack()
+	}
+
+	// The newest entry is the current track, if there is one
+	previous := 0
+	if current != nil {
+		previous = 1
+	}
+
+	entries, err := b.History.Recent(m.GuildID, previous+1)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error reading history: %v", err))
+		return
+	}
+	if len(entries) <= previous {
+		s.ChannelMessageSend(m.ChannelID, "There is no previous track.")
+		return
+	}
+
+	track := b.replayTrack(m, entries[previous])
+	started, err := b.queueTrackNext(s, m.GuildID, m.Author.ID, track)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error adding track: %v", err))
+		return
+	}
+	if started {
+		return
+	}
+
+	player, ok := b.MusicPlayers.Lookup(m.GuildID)
+	if ok && current != nil && (current.Requester == m.Author.ID || b.isDJ(s, m)) {
+		player.Skip()
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("**%s** will play next.", track.Title))
+}
+
+// replayTrack copies a played track so it can be queued again by m's author
+func (b *Bot) replayTrack(m *discordgo.MessageCreate, entry music.HistoryEntry) *music.Track {
+	track := *entry.Track
+	track.Requester = m.Author.ID
+	track.ChannelID = m.ChannelID
+	return &track
+}
+
+func (b *Bot) handleNowPlayingCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+	player, ok := b.MusicPlayers.Lookup(m.GuildID)
+	if !ok || player.GetCurrentTrack() == nil {
+		s.ChannelMessageSend(m.ChannelID, "Nothing is playing.")
+		return
+	}
+
+	s.ChannelMessageSendEmbed(m.ChannelID, nowPlayingEmbed(player))
+}
+
+// nowPlayingEmbed describes the player's current track with a progress bar
+func nowPlayingEmbed(player *music.Player) *discordgo.MessageEmbed {
+	track := player.GetCurrentTrack()
+	position := player.Position()
+
+	length := "?"
+	if track.Duration > 0 {
+		length = music.FormatDuration(track.Duration)
+	}
+
+	status := "▶️"
+	if !player.IsPlaying() {
+		status = "⏸️"
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: track.Title,
+		URL:   track.URL,
+		Description: fmt.Sprintf("%s %s `%s / %s`", status,
+			music.ProgressBar(position, track.Duration, 20), music.FormatDuration(position), length),
+		Color: 0x1DB954,
+	}
+
+	// Radio has no progress to show, only how long we've been listening
+	if track.Live {
+		embed.Description = fmt.Sprintf("%s 🔴 LIVE `%s`", status, music.FormatDuration(position))
+		if title := player.GetStreamTitle(); title != "" {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "On air", Value: title})
+		}
+	}
+
+	if track.Thumbnail != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: track.Thumbnail}
+	}
+
+	if track.Uploader != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Uploader", Value: track.Uploader, Inline: true})
+	}
+
+	if track.Requester != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Requested by", Value: fmt.Sprintf("<@%s>", track.Requester), Inline: true})
+	}
+
+	footer := fmt.Sprintf("Volume: %.0f%% | Loop: %s", player.GetVolume()*100, player.GetLoopMode())
+	if filters := player.GetFilters(); filters.Active() {
+		footer += fmt.Sprintf(" | Filters: %s", filters)
+	}
+	if player.IsNormalized() {
+		footer += " | Normalized"
+	}
+	if transition := player.GetTransition(); transition.Enabled {
+		footer += fmt.Sprintf(" | Transition: %s", transition)
+	}
+	if player.IsAutoplay() {
+		footer += " | Autoplay"
+	}
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: footer}
+
+	return embed
+}
+
+const (
+	// lyricsPageSize is the most characters each page of /lyrics shows,
+	// under Discord's limit on embed descriptions
+	lyricsPageSize = 4000
+
+	// lyricsSyncInterval is how often /lyrics sync checks for lines to post.
+	// Lines that come due together are sent as one message.
+	lyricsSyncInterval = time.Second
+
+	// lyricsSyncLag is how late a synced line may be and still get posted
+	lyricsSyncLag = 5 * time.Second
+)
+
+func (b *Bot) handleLyricsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) > 0 && strings.ToLower(args[0]) == "stop" {
+		if b.stopLyricsSync(m.GuildID) {
+			s.ChannelMessageSend(m.ChannelID, "Stopped synced lyrics.")
+		} else {
+			s.ChannelMessageSend(m.ChannelID, "Synced lyrics are not running.")
+		}
+		return
+	}
+
+	player, ok := b.MusicPlayers.Lookup(m.GuildID)
+	if !ok || player.GetCurrentTrack() == nil {
+		s.ChannelMessageSend(m.ChannelID, "Nothing is playing.")
+		return
+	}
+
+	track := player.GetCurrentTrack()
+	if track.Live {
+		s.ChannelMessageSend(m.ChannelID, "Lyrics are not available for live streams.")
+		return
+	}
+
+	s.ChannelTyping(m.ChannelID)
+
+	found, err := b.Lyrics.Find(lyrics.Query{
+		Title:    track.Title,
+		Artist:   track.Uploader,
+		URL:      track.URL,
+		Duration: track.Duration,
+	})
+	if errors.Is(err, lyrics.ErrNotFound) {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("No lyrics found for **%s**.", track.Title))
+		return
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error finding lyrics: %v", err))
+		return
+	}
+
+	if len(args) > 0 && strings.ToLower(args[0]) == "sync" {
+		if !found.Synced() {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Only unsynced lyrics were found for **%s**, use /lyrics to read them.", track.Title))
+			return
+		}
+		b.startLyricsSync(s, m.GuildID, m.ChannelID, track, found.Lines)
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Posting lyrics for **%s** as it plays. Use /lyrics stop to stop.", track.Title))
+		return
+	}
+
+	view := &LyricsView{
+		Track:   track,
+		Source:  found.Source,
+		Pages:   lyrics.Pages(found.Text(), lyricsPageSize),
+		Created: time.Now(),
+	}
+
+	embed, components := lyricsMessage(view, 0)
+	msg, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	})
+	if err != nil || len(view.Pages) < 2 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Forget lyrics nobody is reading anymore
+	for id, old := range b.LyricsViews {
+		if time.Since(old.Created) > 10*time.Minute {
+			delete(b.LyricsViews, id)
+		}
+	}
+
+	b.LyricsViews[msg.ID] = view
+}
+
+// handleLyricsPage flips a /lyrics message to another page
+func (b *Bot) handleLyricsPage(s *discordgo.Session, i *discordgo.InteractionCreate, choice string) {
+	if i.Message == nil {
+		return
+	}
+
+	var page int
+	if _, err := fmt.Sscanf(choice, "%d", &page); err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	view, ok := b.LyricsViews[i.Message.ID]
+	b.mu.Unlock()
+
+	if !ok {
+		respondEphemeral(s, i, "These lyrics have expired, use /lyrics again.")
+		return
+	}
+
+	embed, components := lyricsMessage(view, page)
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+}
+
+// lyricsMessage renders one page of lyrics, with buttons to flip to the
+// pages around it. Out of range pages show the closest one.
+func lyricsMessage(view *LyricsView, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	pages := len(view.Pages)
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: view.Track.Title,
+		URL:   view.Track.URL,
+		Color: 0x1DB954,
+	}
+	if pages > 0 {
+		embed.Description = view.Pages[page]
+	}
+
+	footer := fmt.Sprintf("Source: %s", view.Source)
+	if pages > 1 {
+		footer = fmt.Sprintf("Page %d/%d | %s", page+1, pages, footer)
+	}
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: footer}
+
+	if pages < 2 {
+		return embed, []discordgo.MessageComponent{}
+	}
+
+	return embed, []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Previous",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("lyrics:%d", page-1),
+				Disabled: page == 0,
+			},
+			discordgo.Button{
+				Label:    "Next",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("lyrics:%d", page+1),
+				Disabled: page == pages-1,
+			},
+		}},
+	}
+}
+
+// subtitleURL finds the track's subtitles or captions in one of the
+// configured languages, for the subtitle lyrics provider
+func (b *Bot) subtitleURL(query lyrics.Query) (string, error) {
+	if !isURL(query.URL) {
+		return "", nil
+	}
+
+	info, err := b.Downloader.GetInfo(query.URL)
+	if err != nil {
+		return "", err
+	}
+
+	return info.SubtitleURL(b.Config.Languages(), "vtt"), nil
+}
+
+// startLyricsSync posts lines of synced lyrics to channelID as track
+// reaches them, replacing any sync already running in the guild
+func (b *Bot) startLyricsSync(s *discordgo.Session, guildID, channelID string, track *music.Track, lines []lyrics.Line) {
+	stop := make(chan struct{})
+
+	b.mu.Lock()
+	if old, ok := b.LyricsSyncs[guildID]; ok {
+		close(old)
+	}
+	b.LyricsSyncs[guildID] = stop
+	b.mu.Unlock()
+
+	go b.followLyrics(s, guildID, channelID, track, lines, stop)
+}
+
+// stopLyricsSync stops the guild's synced lyrics, reporting whether any
+// were running
+func (b *Bot) stopLyricsSync(guildID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stop, ok := b.LyricsSyncs[guildID]
+	if ok {
+		close(stop)
+		delete(b.LyricsSyncs, guildID)
+	}
+	return ok
+}
+
+// followLyrics runs until the lyrics are done, the track stops playing or
+// stop is closed
+func (b *Bot) followLyrics(s *discordgo.Session, guildID, channelID string, track *music.Track, lines []lyrics.Line, stop chan struct{}) {
+	defer func() {
+		b.mu.Lock()
+		if b.LyricsSyncs[guildID] == stop {
+			delete(b.LyricsSyncs, guildID)
+		}
+		b.mu.Unlock()
+	}()
+
+	follower := lyrics.NewFollower(lines)
+	ticker := time.NewTicker(lyricsSyncInterval)
+	defer ticker.Stop()
+
+	for !follower.Done() {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		player, ok := b.MusicPlayers.Lookup(guildID)
+		if !ok || player.GetCurrentTrack() != track {
+			return
+		}
+
+		// Blank lines mark instrumental breaks, there's nothing to post
+		var texts []string
+		for _, line := range follower.Advance(player.Position(), lyricsSyncLag) {
+			if line.Text != "" {
+				texts = append(texts, line.Text)
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+
+		s.ChannelMessageSend(channelID, "🎤 "+strings.Join(texts, "\n"))
+	}
 }
 
 func (b *Bot) handleHelpCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
@@ -602,13 +3323,36 @@ func (b *Bot) handleHelpCommand(s *discordgo.Session, m *discordgo.MessageCreate
 		"/help - Show this help message\n"+
 		"/ai <question> - Ask the AI a question\n"+
 		"/download <url> [-a] - Download video/audio from URL (-a for audio only)\n"+
-		"/play <url> - Play audio from URL\n"+
+		"/jobs - List running and queued downloads\n"+
+		"/cancel <number> - Cancel a download (admins can cancel anyone's)\n"+
+		"/play <url|song name> - Play audio from a URL or the top search result\n"+
+		"/search-music <song name> - Pick from the top 5 search results\n"+
 		"/pause - Pause playback\n"+
 		"/resume - Resume playback\n"+
-		"/skip - Skip to next track\n"+
-		"/stop - Stop playback and clear queue\n"+
-		"/queue - Show current queue\n"+
-		"/volume [level] - Show or set volume (0-100)")
+		"/skip - Skip to next track, or vote to skip if you are not a DJ\n"+
+		"/stop - Stop playback and clear queue (DJ only)\n"+
+		"/queue [page] - Show the queue, with buttons to flip pages\n"+
+		"/playnext <url|song name> - Queue a track to play after the current one\n"+
+		"/move <from> <to> - Move a track in the queue (DJ only)\n"+
+		"/remove <position> - Remove a track from the queue (your own, or any as DJ)\n"+
+		"/skipto <position> - Skip ahead to a track in the queue (DJ only)\n"+
+		"/clear - Clear the queue but keep the current track (DJ only)\n"+
+		"/volume [level] - Show or set volume (0-100, DJ only)\n"+
+		"/loop [off|track|queue] - Set or cycle the loop mode\n"+
+		"/shuffle [off] - Shuffle the queue, or restore its order\n"+
+		"/seek <mm:ss> - Jump to a position in the current track\n"+
+		"/radio [list|name|url] - List radio stations or tune in to one\n"+
+		"/filter [preset|speed|pitch|eq|off] - Show or change audio filters (DJ only)\n"+
+		"/normalize [on|off] - Show or toggle loudness normalization (DJ only)\n"+
+		"/crossfade [seconds|gapless|off] - Show or set the transition between tracks (DJ only)\n"+
+		"/autoplay [on|off] - Play related tracks when the queue runs out\n"+
+		"/sponsorblock [on|off] - Show or toggle skipping sponsor segments and silence, off by default (DJ only)\n"+
+		"/playlist <save|load|list|delete|add|remove|export|import> [server] <name> - Manage saved playlists\n"+
+		"/history [top] - Show recently played tracks, or this week's most played\n"+
+		"/replay <number> - Play a track from /history again next\n"+
+		"/back - Go back to the previous track\n"+
+		"/nowplaying - Show the current track and its progress\n"+
+		"/lyrics [sync|stop] - Show the current track's lyrics, or post synced lyrics as it plays")
 
 	s.ChannelMessageSend(m.ChannelID, helpText)
 }
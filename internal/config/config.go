@@ -1,17 +1,40 @@
 package config
 
 import (
+	"strings"
+
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	DiscordToken           string `mapstructure:"DISCORD_TOKEN"`
-	OpenRouterAPIKey       string `mapstructure:"OPENROUTER_API_KEY"`
-	GoogleSearchAPIKey     string `mapstructure:"GOOGLE_SEARCH_API_KEY"`
-	GoogleSearchEngineID   string `mapstructure:"GOOGLE_SEARCH_ENGINE_ID"`
-	BotPrefix              string `mapstructure:"BOT_PREFIX"`
-	MaxConcurrentDownloads int    `mapstructure:"MAX_CONCURRENT_DOWNLOADS"`
-	MaxFileSize            int    `mapstructure:"MAX_FILE_SIZE"`
+	DiscordToken           string  `mapstructure:"DISCORD_TOKEN"`
+	OpenRouterAPIKey       string  `mapstructure:"OPENROUTER_API_KEY"`
+	GoogleSearchAPIKey     string  `mapstructure:"GOOGLE_SEARCH_API_KEY"`
+	GoogleSearchEngineID   string  `mapstructure:"GOOGLE_SEARCH_ENGINE_ID"`
+	BotPrefix              string  `mapstructure:"BOT_PREFIX"`
+	MaxConcurrentDownloads int     `mapstructure:"MAX_CONCURRENT_DOWNLOADS"`
+	MaxDownloadsPerUser    int     `mapstructure:"MAX_DOWNLOADS_PER_USER"` // Downloads one user may have queued or running, 0 for no limit
+	MaxFileSize            int     `mapstructure:"MAX_FILE_SIZE"`
+	MaxTrackLength         int     `mapstructure:"MAX_TRACK_LENGTH"` // In minutes, 0 for no limit
+	MaxPlaylistSize        int     `mapstructure:"MAX_PLAYLIST_SIZE"`
+	RadioStations          string  `mapstructure:"RADIO_STATIONS"` // name=url pairs separated by commas
+	MusicStateDir          string  `mapstructure:"MUSIC_STATE_DIR"`
+	PlaylistDir            string  `mapstructure:"PLAYLIST_DIR"`
+	HistoryDir             string  `mapstructure:"HISTORY_DIR"`
+	DJRole                 string  `mapstructure:"DJ_ROLE"`                 // Role name or ID allowed to skip without votes and stop
+	SkipVoteRatio          float64 `mapstructure:"SKIP_VOTE_RATIO"`         // Share of listeners needed to vote-skip
+	IdleTimeout            int     `mapstructure:"IDLE_TIMEOUT"`            // Minutes with nothing playing before leaving voice
+	EmptyChannelGrace      int     `mapstructure:"EMPTY_CHANNEL_GRACE"`     // Seconds to wait for someone to rejoin, 0 to leave at once
+	LyricsAPIURL           string  `mapstructure:"LYRICS_API_URL"`          // LRCLIB compatible lyrics API, empty to only use subtitles
+	LyricsLanguages        string  `mapstructure:"LYRICS_LANGUAGES"`        // Subtitle languages to try, separated by commas
+	SponsorBlockAPIURL     string  `mapstructure:"SPONSORBLOCK_API_URL"`    // Empty to not skip sponsor segments
+	SponsorBlockCategories string  `mapstructure:"SPONSORBLOCK_CATEGORIES"` // Segment categories to skip, separated by commas
+	TrimSilence            bool    `mapstructure:"TRIM_SILENCE"`            // Skip silence at the start and end of tracks
+}
+
+type RadioStation struct {
+	Name string
+	URL  string
 }
 
 func LoadConfig() (*Config, error) {
@@ -21,7 +44,21 @@ func LoadConfig() (*Config, error) {
 	// Default values
 	viper.SetDefault("BOT_PREFIX", "/")
 	viper.SetDefault("MAX_CONCURRENT_DOWNLOADS", 3)
+	viper.SetDefault("MAX_DOWNLOADS_PER_USER", 2)
 	viper.SetDefault("MAX_FILE_SIZE", 100)
+	viper.SetDefault("MAX_TRACK_LENGTH", 60)
+	viper.SetDefault("MAX_PLAYLIST_SIZE", 50)
+	viper.SetDefault("MUSIC_STATE_DIR", "data/music")
+	viper.SetDefault("PLAYLIST_DIR", "data/playlists")
+	viper.SetDefault("HISTORY_DIR", "data/history")
+	viper.SetDefault("SKIP_VOTE_RATIO", 0.5)
+	viper.SetDefault("IDLE_TIMEOUT", 5)
+	viper.SetDefault("EMPTY_CHANNEL_GRACE", 60)
+	viper.SetDefault("LYRICS_API_URL", "https://lrclib.net")
+	viper.SetDefault("LYRICS_LANGUAGES", "en,id")
+	viper.SetDefault("SPONSORBLOCK_API_URL", "https://sponsor.ajay.app")
+	viper.SetDefault("SPONSORBLOCK_CATEGORIES", "sponsor,selfpromo,interaction,intro,outro,music_offtopic")
+	viper.SetDefault("TRIM_SILENCE", false)
 
 	if err := viper.ReadInConfig(); err != nil {
 		// Jika file .env tidak ditemukan, kita tetap bisa menggunakan environment variables
@@ -36,4 +73,53 @@ func LoadConfig() (*Config, error) {
 	}
 
 	return &config, nil
-}
\ No newline at end of file
+}
+
+// Stations parses RadioStations into a list of named stations,
+// skipping entries without a name or URL.
+func (c *Config) Stations() []RadioStation {
+	var stations []RadioStation
+
+	for _, entry := range strings.Split(c.RadioStations, ",") {
+		name, url, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		url = strings.TrimSpace(url)
+		if name == "" || url == "" {
+			continue
+		}
+
+		stations = append(stations, RadioStation{Name: name, URL: url})
+	}
+
+	return stations
+}
+
+// Languages parses LyricsLanguages into a list of subtitle language
+// codes, skipping empty entries.
+func (c *Config) Languages() []string {
+	return splitList(c.LyricsLanguages)
+}
+
+// Categories parses SponsorBlockCategories into a list of categories,
+// skipping empty entries.
+func (c *Config) Categories() []string {
+	return splitList(c.SponsorBlockCategories)
+}
+
+// splitList splits a comma separated setting into lowercase entries
+func splitList(value string) []string {
+	var entries []string
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
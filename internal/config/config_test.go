@@ -82,7 +82,101 @@ func TestLoadConfigDefaults(t *testing.T) {
 		t.Errorf("Expected MaxConcurrentDownloads to be 3 (default), got %d", config.MaxConcurrentDownloads)
 	}
 
+	if config.MaxDownloadsPerUser != 2 {
+		t.Errorf("Expected MaxDownloadsPerUser to be 2 (default), got %d", config.MaxDownloadsPerUser)
+	}
+
 	if config.MaxFileSize != 100 {
 		t.Errorf("Expected MaxFileSize to be 100 (default), got %d", config.MaxFileSize)
 	}
-}
\ No newline at end of file
+
+	if config.MaxTrackLength != 60 {
+		t.Errorf("Expected MaxTrackLength to be 60 (default), got %d", config.MaxTrackLength)
+	}
+
+	if config.MaxPlaylistSize != 50 {
+		t.Errorf("Expected MaxPlaylistSize to be 50 (default), got %d", config.MaxPlaylistSize)
+	}
+
+	if config.MusicStateDir != "data/music" {
+		t.Errorf("Expected MusicStateDir to be 'data/music' (default), got '%s'", config.MusicStateDir)
+	}
+
+	if config.SkipVoteRatio != 0.5 {
+		t.Errorf("Expected SkipVoteRatio to be 0.5 (default), got %v", config.SkipVoteRatio)
+	}
+
+	if config.PlaylistDir != "data/playlists" {
+		t.Errorf("Expected PlaylistDir to be 'data/playlists' (default), got '%s'", config.PlaylistDir)
+	}
+
+	if config.HistoryDir != "data/history" {
+		t.Errorf("Expected HistoryDir to be 'data/history' (default), got '%s'", config.HistoryDir)
+	}
+
+	if config.IdleTimeout != 5 {
+		t.Errorf("Expected IdleTimeout to be 5 (default), got %d", config.IdleTimeout)
+	}
+
+	if config.EmptyChannelGrace != 60 {
+		t.Errorf("Expected EmptyChannelGrace to be 60 (default), got %d", config.EmptyChannelGrace)
+	}
+
+	if config.LyricsAPIURL != "https://lrclib.net" {
+		t.Errorf("Expected LyricsAPIURL to be 'https://lrclib.net' (default), got '%s'", config.LyricsAPIURL)
+	}
+
+	if config.LyricsLanguages != "en,id" {
+		t.Errorf("Expected LyricsLanguages to be 'en,id' (default), got '%s'", config.LyricsLanguages)
+	}
+
+	if config.SponsorBlockAPIURL != "https://sponsor.ajay.app" {
+		t.Errorf("Expected SponsorBlockAPIURL to be 'https://sponsor.ajay.app' (default), got '%s'", config.SponsorBlockAPIURL)
+	}
+
+	if len(config.Categories()) != 6 {
+		t.Errorf("Expected 6 SponsorBlock categories (default), got %v", config.Categories())
+	}
+
+	if config.TrimSilence {
+		t.Error("Expected TrimSilence to be false (default)")
+	}
+}
+
+func TestStations(t *testing.T) {
+	config := &Config{
+		RadioStations: "GrooveSalad=https://ice1.somafm.com/groovesalad-128-mp3, broken, =https://example.com,lofi = https://example.com/lofi.m3u8 ,",
+	}
+
+	stations := config.Stations()
+	if len(stations) != 2 {
+		t.Fatalf("Expected 2 stations, got %d", len(stations))
+	}
+
+	if stations[0].Name != "groovesalad" || stations[0].URL != "https://ice1.somafm.com/groovesalad-128-mp3" {
+		t.Errorf("Expected first station to be groovesalad, got %+v", stations[0])
+	}
+
+	if stations[1].Name != "lofi" || stations[1].URL != "https://example.com/lofi.m3u8" {
+		t.Errorf("Expected second station to be lofi, got %+v", stations[1])
+	}
+
+	empty := &Config{}
+	if len(empty.Stations()) != 0 {
+		t.Errorf("Expected no stations when RADIO_STATIONS is empty")
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	config := &Config{LyricsLanguages: " EN, ,id,"}
+
+	languages := config.Languages()
+	if len(languages) != 2 || languages[0] != "en" || languages[1] != "id" {
+		t.Errorf("Expected [en id], got %v", languages)
+	}
+
+	config = &Config{SponsorBlockCategories: "Sponsor,music_offtopic"}
+	if categories := config.Categories(); len(categories) != 2 || categories[0] != "sponsor" {
+		t.Errorf("Expected [sponsor music_offtopic], got %v", categories)
+	}
+}
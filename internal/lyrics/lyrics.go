@@ -0,0 +1,237 @@
+package lyrics
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line is one line of lyrics, with the time it is sung at for synced
+// lyrics.
+type Line struct {
+	Time time.Duration
+	Text string
+}
+
+// Lyrics are the words of a track, either plain or synced to playback.
+type Lyrics struct {
+	Source string // Where the lyrics were found, e.g. "YouTube captions"
+	Plain  string
+	Lines  []Line // Timed lines, empty if the lyrics aren't synced
+}
+
+// Synced reports whether the lyrics carry a time for every line.
+func (l *Lyrics) Synced() bool {
+	return len(l.Lines) > 0
+}
+
+// Text returns the lyrics as plain text, one line per line.
+func (l *Lyrics) Text() string {
+	if strings.TrimSpace(l.Plain) != "" || !l.Synced() {
+		return strings.TrimSpace(l.Plain)
+	}
+
+	texts := make([]string, len(l.Lines))
+	for i, line := range l.Lines {
+		texts[i] = line.Text
+	}
+	return strings.TrimSpace(strings.Join(texts, "\n"))
+}
+
+// Pages splits text into pages of at most size characters, breaking
+// between lines where possible.
+func Pages(text string, size int) []string {
+	var pages []string
+	var page strings.Builder
+
+	flush := func() {
+		if strings.TrimSpace(page.String()) != "" {
+			pages = append(pages, strings.TrimSpace(page.String()))
+		}
+		page.Reset()
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		// A single line longer than a page is cut where it has to be
+		for len([]rune(line)) > size {
+			flush()
+			runes := []rune(line)
+			pages = append(pages, string(runes[:size]))
+			line = string(runes[size:])
+		}
+
+		if page.Len() > 0 && len([]rune(page.String()))+1+len([]rune(line)) > size {
+			flush()
+		}
+		if page.Len() > 0 {
+			page.WriteByte('\n')
+		}
+		page.WriteString(line)
+	}
+	flush()
+
+	return pages
+}
+
+var lrcTimestamp = regexp.MustCompile(`\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+
+// ParseLRC reads synced lyrics in LRC format. Lines may carry several
+// timestamps; tags like [ar:...] and untimed lines are ignored.
+func ParseLRC(text string) []Line {
+	var lines []Line
+
+	for _, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimSpace(raw)
+
+		matches := lrcTimestamp.FindAllStringSubmatchIndex(raw, -1)
+		if len(matches) == 0 || matches[0][0] != 0 {
+			continue
+		}
+
+		// Timestamps lead the line, the words follow the last one
+		end := 0
+		var times []time.Duration
+		for _, match := range matches {
+			if match[0] != end {
+				break
+			}
+			end = match[1]
+
+			minutes, _ := strconv.Atoi(raw[match[2]:match[3]])
+			seconds, _ := strconv.Atoi(raw[match[4]:match[5]])
+			at := time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+			if match[6] >= 0 {
+				fraction := raw[match[6]:match[7]]
+				ms, _ := strconv.Atoi((fraction + "00")[:3])
+				at += time.Duration(ms) * time.Millisecond
+			}
+			times = append(times, at)
+		}
+
+		text := strings.TrimSpace(raw[end:])
+		for _, at := range times {
+			lines = append(lines, Line{Time: at, Text: text})
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time < lines[j].Time
+	})
+
+	return lines
+}
+
+var (
+	vttTiming = regexp.MustCompile(`^((?:\d+:)?\d{1,2}:\d{2}[.,]\d{3})\s+-->\s+`)
+	vttTag    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ParseVTT reads the cues of a WebVTT subtitle file as timed lines.
+// Automatic captions repeat each line in the next cues as it scrolls, so
+// a line that was among the last few is dropped.
+func ParseVTT(text string) []Line {
+	var lines []Line
+
+	var start time.Duration
+	inCue := false
+
+	for _, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		raw = strings.TrimSpace(raw)
+
+		if match := vttTiming.FindStringSubmatch(raw); match != nil {
+			start = parseVTTTime(match[1])
+			inCue = true
+			continue
+		}
+
+		if raw == "" {
+			inCue = false
+			continue
+		}
+
+		if !inCue {
+			continue
+		}
+
+		line := strings.TrimSpace(vttTag.ReplaceAllString(raw, ""))
+		line = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&nbsp;", " ").Replace(line)
+
+		// Skip empty lines and sound descriptions like [Music]
+		if line == "" || (strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]")) {
+			continue
+		}
+
+		if recentlySeen(lines, line, 3) {
+			continue
+		}
+
+		lines = append(lines, Line{Time: start, Text: line})
+	}
+
+	return lines
+}
+
+// recentlySeen reports whether line is among the last n lines
+func recentlySeen(lines []Line, line string, n int) bool {
+	for i := len(lines) - 1; i >= 0 && i >= len(lines)-n; i-- {
+		if lines[i].Text == line {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVTTTime parses "mm:ss.ttt" or "hh:mm:ss.ttt"
+func parseVTTTime(s string) time.Duration {
+	parts := strings.Split(strings.ReplaceAll(s, ",", "."), ":")
+
+	minutes := 0
+	for _, part := range parts[:len(parts)-1] {
+		value, _ := strconv.Atoi(part)
+		minutes = minutes*60 + value
+	}
+	seconds, _ := strconv.ParseFloat(parts[len(parts)-1], 64)
+
+	return time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+}
+
+// Follower tracks which synced lines have come due as playback moves on.
+type Follower struct {
+	lines []Line
+	next  int
+	last  time.Duration // Position at the previous call
+}
+
+func NewFollower(lines []Line) *Follower {
+	return &Follower{lines: lines}
+}
+
+// Advance returns the lines that came due since the last call, given the
+// current playback position. Lines more than lag behind the position are
+// skipped, so a seek forward doesn't post a burst of old lines. Seeking
+// backwards starts over from the new position.
+func (f *Follower) Advance(position, lag time.Duration) []Line {
+	if position < f.last {
+		f.next = sort.Search(len(f.lines), func(i int) bool {
+			return f.lines[i].Time >= position
+		})
+	}
+	f.last = position
+
+	var due []Line
+	for f.next < len(f.lines) && f.lines[f.next].Time <= position {
+		if position-f.lines[f.next].Time <= lag {
+			due = append(due, f.lines[f.next])
+		}
+		f.next++
+	}
+
+	return due
+}
+
+// Done reports whether every line has come due.
+func (f *Follower) Done() bool {
+	return f.next >= len(f.lines)
+}
@@ -0,0 +1,140 @@
+package lyrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLRC(t *testing.T) {
+	lrc := `[ar:Artist]
+[ti:Song]
+[00:12.50]First line
+[00:15.123][01:02.00]Repeated line
+[00:20]Third line
+not a timed line`
+
+	lines := ParseLRC(lrc)
+
+	expected := []Line{
+		{12*time.Second + 500*time.Millisecond, "First line"},
+		{15*time.Second + 123*time.Millisecond, "Repeated line"},
+		{20 * time.Second, "Third line"},
+		{62 * time.Second, "Repeated line"},
+	}
+
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d: %v", len(expected), len(lines), lines)
+	}
+	for i, want := range expected {
+		if lines[i] != want {
+			t.Errorf("Line %d: expected %v, got %v", i, want, lines[i])
+		}
+	}
+}
+
+func TestParseVTT(t *testing.T) {
+	vtt := `WEBVTT
+Kind: captions
+Language: en
+
+00:00:01.000 --> 00:00:03.000 align:start position:0%
+[Music]
+
+00:00:03.500 --> 00:00:05.000
+<c>never gonna</c><00:00:04.000><c> give you up</c>
+
+00:00:05.000 --> 00:00:07.000
+never gonna give you up
+never gonna let you down
+
+01:02:03.250 --> 01:02:05.000
+tom &amp; jerry
+`
+
+	lines := ParseVTT(vtt)
+
+	expected := []Line{
+		{3500 * time.Millisecond, "never gonna give you up"},
+		{5 * time.Second, "never gonna let you down"},
+		{time.Hour + 2*time.Minute + 3250*time.Millisecond, "tom & jerry"},
+	}
+
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d: %v", len(expected), len(lines), lines)
+	}
+	for i, want := range expected {
+		if lines[i] != want {
+			t.Errorf("Line %d: expected %v, got %v", i, want, lines[i])
+		}
+	}
+}
+
+func TestLyricsText(t *testing.T) {
+	plain := &Lyrics{Plain: "  one\ntwo \n"}
+	if plain.Synced() || plain.Text() != "one\ntwo" {
+		t.Errorf("Unexpected plain lyrics: synced %v, text %q", plain.Synced(), plain.Text())
+	}
+
+	synced := &Lyrics{Lines: []Line{{0, "one"}, {time.Second, "two"}}}
+	if !synced.Synced() || synced.Text() != "one\ntwo" {
+		t.Errorf("Unexpected synced lyrics: synced %v, text %q", synced.Synced(), synced.Text())
+	}
+}
+
+func TestPages(t *testing.T) {
+	text := strings.Repeat("0123456789\n", 10)
+
+	pages := Pages(text, 35)
+	if len(pages) != 4 {
+		t.Fatalf("Expected 4 pages, got %d: %q", len(pages), pages)
+	}
+	for i, page := range pages {
+		if len(page) > 35 {
+			t.Errorf("Page %d is %d characters long", i, len(page))
+		}
+		if strings.HasPrefix(page, "\n") || strings.Contains(page, "0123456789"+"0") {
+			t.Errorf("Page %d splits a line: %q", i, page)
+		}
+	}
+
+	// Lines longer than a page are cut
+	pages = Pages(strings.Repeat("x", 25), 10)
+	if len(pages) != 3 || pages[2] != "xxxxx" {
+		t.Errorf("Expected a long line cut into 3 pages, got %q", pages)
+	}
+
+	if pages := Pages("  \n", 10); len(pages) != 0 {
+		t.Errorf("Expected no pages for blank text, got %q", pages)
+	}
+}
+
+func TestFollower(t *testing.T) {
+	lines := []Line{{1 * time.Second, "a"}, {2 * time.Second, "b"}, {3 * time.Second, "c"}, {10 * time.Second, "d"}, {11 * time.Second, "e"}}
+	follower := NewFollower(lines)
+
+	if due := follower.Advance(500*time.Millisecond, 5*time.Second); len(due) != 0 {
+		t.Errorf("Expected no lines before the first, got %v", due)
+	}
+
+	if due := follower.Advance(2*time.Second, 5*time.Second); len(due) != 2 || due[0].Text != "a" || due[1].Text != "b" {
+		t.Errorf("Expected a and b, got %v", due)
+	}
+
+	// Seeking back starts over from there
+	if due := follower.Advance(0, 5*time.Second); len(due) != 0 {
+		t.Errorf("Expected nothing right after seeking back, got %v", due)
+	}
+	if due := follower.Advance(time.Second, 5*time.Second); len(due) != 1 || due[0].Text != "a" {
+		t.Errorf("Expected a again after seeking back, got %v", due)
+	}
+
+	// Lines long past are skipped after seeking forward
+	if due := follower.Advance(11*time.Second, 5*time.Second); len(due) != 2 || due[0].Text != "d" || due[1].Text != "e" {
+		t.Errorf("Expected only d and e after seeking forward, got %v", due)
+	}
+
+	if !follower.Done() {
+		t.Error("Expected follower to be done after the last line")
+	}
+}
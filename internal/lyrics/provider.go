@@ -0,0 +1,218 @@
+package lyrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by providers that have no lyrics for a track.
+var ErrNotFound = errors.New("no lyrics found")
+
+// Query describes the track to find lyrics for.
+type Query struct {
+	Title    string
+	Artist   string
+	URL      string
+	Duration time.Duration
+}
+
+// Provider looks up lyrics for a track.
+type Provider interface {
+	Find(query Query) (*Lyrics, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface.
+type ProviderFunc func(query Query) (*Lyrics, error)
+
+func (f ProviderFunc) Find(query Query) (*Lyrics, error) {
+	return f(query)
+}
+
+// Chain tries each provider in turn and returns the first lyrics found.
+// If none has any, the first error other than ErrNotFound is returned.
+func Chain(providers ...Provider) Provider {
+	return ProviderFunc(func(query Query) (*Lyrics, error) {
+		var firstErr error
+		for _, provider := range providers {
+			lyrics, err := provider.Find(query)
+			if err == nil && lyrics != nil && lyrics.Text() != "" {
+				return lyrics, nil
+			}
+			if err != nil && !errors.Is(err, ErrNotFound) && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, ErrNotFound
+	})
+}
+
+// SubtitleProvider turns a track's subtitles or captions into lyrics.
+// Lookup returns the URL of a WebVTT file for the track, or "" if it has
+// none.
+type SubtitleProvider struct {
+	Lookup func(query Query) (string, error)
+	Client *http.Client
+}
+
+func (p *SubtitleProvider) Find(query Query) (*Lyrics, error) {
+	subtitleURL, err := p.Lookup(query)
+	if err != nil {
+		return nil, err
+	}
+	if subtitleURL == "" {
+		return nil, ErrNotFound
+	}
+
+	data, err := get(p.Client, subtitleURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download subtitles: %w", err)
+	}
+
+	lines := ParseVTT(string(data))
+	if len(lines) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &Lyrics{Source: "subtitles", Lines: lines}, nil
+}
+
+// HTTPProvider finds lyrics with an LRCLIB compatible API.
+type HTTPProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewHTTPProvider(baseURL string) *HTTPProvider {
+	return &HTTPProvider{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type lrclibRecord struct {
+	TrackName    string  `json:"trackName"`
+	ArtistName   string  `json:"artistName"`
+	Duration     float64 `json:"duration"`
+	Instrumental bool    `json:"instrumental"`
+	PlainLyrics  string  `json:"plainLyrics"`
+	SyncedLyrics string  `json:"syncedLyrics"`
+}
+
+// Find looks the track up by title, artist and length, falling back to a
+// search by title and artist.
+func (p *HTTPProvider) Find(query Query) (*Lyrics, error) {
+	artist, title := CleanTitle(query.Title, query.Artist)
+	if title == "" {
+		return nil, ErrNotFound
+	}
+
+	params := url.Values{}
+	params.Set("track_name", title)
+	params.Set("artist_name", artist)
+	if query.Duration > 0 {
+		params.Set("duration", fmt.Sprint(int(query.Duration.Seconds())))
+	}
+
+	var record lrclibRecord
+	err := p.getJSON("/api/get?"+params.Encode(), &record)
+	if err == nil && (record.PlainLyrics != "" || record.SyncedLyrics != "") {
+		return p.lyrics(record), nil
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	var records []lrclibRecord
+	search := url.Values{}
+	search.Set("q", strings.TrimSpace(artist+" "+title))
+	if err := p.getJSON("/api/search?"+search.Encode(), &records); err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		if record.PlainLyrics != "" || record.SyncedLyrics != "" {
+			return p.lyrics(record), nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (p *HTTPProvider) lyrics(record lrclibRecord) *Lyrics {
+	return &Lyrics{
+		Source: p.BaseURL,
+		Plain:  record.PlainLyrics,
+		Lines:  ParseLRC(record.SyncedLyrics),
+	}
+}
+
+func (p *HTTPProvider) getJSON(path string, v interface{}) error {
+	data, err := get(p.Client, p.BaseURL+path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse lyrics response: %w", err)
+	}
+	return nil
+}
+
+// get fetches target, treating 404 as ErrNotFound
+func get(client *http.Client, target string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lyrics request failed with status %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+}
+
+var (
+	// Bracketed notes like (Official Video) or [Lyrics]
+	titleNoise = regexp.MustCompile(`(?i)\s*[\(\[][^\)\]]*(official|video|lyric|audio|visuali[sz]er|mv|hd|4k|remaster)[^\)\]]*[\)\]]`)
+	// Featured artists, which lyrics sites leave out of the title
+	titleFeat = regexp.MustCompile(`(?i)\s+(feat\.?|ft\.?|featuring)\s+.*$`)
+)
+
+// CleanTitle guesses the artist and song title from a video title such
+// as "Artist - Song (Official Video)", using uploader as the artist when
+// the title doesn't name one.
+func CleanTitle(title, uploader string) (artist, song string) {
+	title = strings.TrimSpace(titleNoise.ReplaceAllString(title, ""))
+
+	artist = strings.TrimSpace(uploader)
+	artist = strings.TrimSuffix(artist, " - Topic")
+	artist = strings.TrimSuffix(artist, "VEVO")
+
+	song = title
+	if parts := strings.SplitN(title, " - ", 2); len(parts) == 2 {
+		artist, song = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	}
+
+	song = strings.Trim(titleFeat.ReplaceAllString(song, ""), ` "'`)
+	return strings.TrimSpace(artist), song
+}
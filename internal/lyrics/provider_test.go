@@ -0,0 +1,116 @@
+package lyrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPProvider(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+
+		switch r.URL.Path {
+		case "/api/get":
+			if r.URL.Query().Get("track_name") == "Known Song" {
+				w.Write([]byte(`{"trackName": "Known Song", "plainLyrics": "la la", "syncedLyrics": "[00:01.00]la la"}`))
+				return
+			}
+			http.NotFound(w, r)
+		case "/api/search":
+			w.Write([]byte(`[{"trackName": "Other", "instrumental": true}, {"trackName": "Other", "plainLyrics": "found by search"}]`))
+		}
+	}))
+	defer server.Close()
+
+	provider := NewHTTPProvider(server.URL + "/")
+
+	lyrics, err := provider.Find(Query{Title: "Artist - Known Song (Official Video)", Duration: 200 * time.Second})
+	if err != nil {
+		t.Fatalf("Failed to find lyrics: %v", err)
+	}
+	if lyrics.Text() != "la la" || !lyrics.Synced() || lyrics.Lines[0].Time != time.Second {
+		t.Errorf("Unexpected lyrics: %+v", lyrics)
+	}
+	if queries[0] != "/api/get?artist_name=Artist&duration=200&track_name=Known+Song" {
+		t.Errorf("Unexpected lookup: %s", queries[0])
+	}
+
+	// Not found by exact lookup, so search instead
+	lyrics, err = provider.Find(Query{Title: "Other", Artist: "Someone - Topic"})
+	if err != nil {
+		t.Fatalf("Failed to find lyrics by search: %v", err)
+	}
+	if lyrics.Text() != "found by search" || lyrics.Synced() {
+		t.Errorf("Unexpected lyrics from search: %+v", lyrics)
+	}
+	if last := queries[len(queries)-1]; last != "/api/search?q=Someone+Other" {
+		t.Errorf("Unexpected search: %s", last)
+	}
+}
+
+func TestSubtitleProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("WEBVTT\n\n00:01.000 --> 00:02.000\nhello\n"))
+	}))
+	defer server.Close()
+
+	provider := &SubtitleProvider{Lookup: func(query Query) (string, error) {
+		if query.URL == "no-subs" {
+			return "", nil
+		}
+		return server.URL + "/subs.vtt", nil
+	}}
+
+	lyrics, err := provider.Find(Query{URL: "video"})
+	if err != nil {
+		t.Fatalf("Failed to find lyrics: %v", err)
+	}
+	if len(lyrics.Lines) != 1 || lyrics.Lines[0].Text != "hello" || lyrics.Lines[0].Time != time.Second {
+		t.Errorf("Unexpected lyrics: %+v", lyrics)
+	}
+
+	if _, err := provider.Find(Query{URL: "no-subs"}); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound without subtitles, got %v", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	failing := ProviderFunc(func(Query) (*Lyrics, error) { return nil, errors.New("offline") })
+	missing := ProviderFunc(func(Query) (*Lyrics, error) { return nil, ErrNotFound })
+	found := ProviderFunc(func(Query) (*Lyrics, error) { return &Lyrics{Plain: "words"}, nil })
+
+	lyrics, err := Chain(failing, missing, found).Find(Query{})
+	if err != nil || lyrics.Text() != "words" {
+		t.Errorf("Expected lyrics from the last provider, got %v (%v)", lyrics, err)
+	}
+
+	if _, err := Chain(missing, failing).Find(Query{}); err == nil || err.Error() != "offline" {
+		t.Errorf("Expected the provider error, got %v", err)
+	}
+
+	if _, err := Chain(missing).Find(Query{}); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		title, uploader string
+		artist, song    string
+	}{
+		{"Rick Astley - Never Gonna Give You Up (Official Music Video)", "Rick Astley", "Rick Astley", "Never Gonna Give You Up"},
+		{"Blinding Lights", "The Weeknd - Topic", "The Weeknd", "Blinding Lights"},
+		{"Song Title [Lyrics] feat. Someone", "ArtistVEVO", "Artist", "Song Title"},
+	}
+
+	for _, tt := range tests {
+		artist, song := CleanTitle(tt.title, tt.uploader)
+		if artist != tt.artist || song != tt.song {
+			t.Errorf("CleanTitle(%q, %q) = %q, %q; expected %q, %q", tt.title, tt.uploader, artist, song, tt.artist, tt.song)
+		}
+	}
+}
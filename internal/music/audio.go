@@ -0,0 +1,273 @@
+package music
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FrameDuration is the length of audio carried by a single Opus frame.
+// Discord expects 20ms frames at 48kHz stereo.
+const FrameDuration = 20 * time.Millisecond
+
+// StreamOptions controls how an AudioSource renders a track.
+type StreamOptions struct {
+	Volume    float64       // 0.0 - 1.0
+	Start     time.Duration // Offset into the track to start from
+	Filters   FilterSet     // Audio effects to apply
+	Normalize bool          // EBU R128 loudness normalization
+
+	// Next, if set, is played straight after the track in the same stream,
+	// overlapping its end by Crossfade
+	Next      *Track
+	Crossfade time.Duration
+}
+
+// FrameReader yields encoded Opus frames one at a time.
+// ReadFrame returns io.EOF once the track has finished.
+type FrameReader interface {
+	ReadFrame() ([]byte, error)
+	Close() error
+}
+
+// AudioSource turns a track into a stream of Opus frames.
+type AudioSource interface {
+	Open(track *Track, opts StreamOptions) (FrameReader, error)
+}
+
+// FFmpegSource encodes tracks to Opus by piping them through ffmpeg.
+type FFmpegSource struct {
+	Path    string // ffmpeg binary, defaults to "ffmpeg"
+	Bitrate string // Opus bitrate, defaults to "96k"
+}
+
+func NewFFmpegSource() *FFmpegSource {
+	return &FFmpegSource{
+		Path:    "ffmpeg",
+		Bitrate: "96k",
+	}
+}
+
+func (f *FFmpegSource) Open(track *Track, opts StreamOptions) (FrameReader, error) {
+	cmd := exec.Command(f.Path, f.args(track, opts)...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ffmpeg pipe: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	return &ffmpegStream{
+		cmd:    cmd,
+		stderr: &stderr,
+		ogg:    newOggOpusReader(bufio.NewReaderSize(stdout, 16*1024)),
+	}, nil
+}
+
+func (f *FFmpegSource) args(track *Track, opts StreamOptions) []string {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	args = append(args, inputArgs(track, opts.Start)...)
+
+	bitrate := f.Bitrate
+	if bitrate == "" {
+		bitrate = "96k"
+	}
+
+	// Effects and volume apply after tracks are joined, so they carry
+	// through a transition unchanged
+	post := opts.Filters.Filters()
+	post = append(post, fmt.Sprintf("volume=%.2f", opts.Volume))
+
+	if opts.Next != nil {
+		args = append(args, inputArgs(opts.Next, 0)...)
+
+		join := "concat=n=2:v=0:a=1"
+		if opts.Crossfade > 0 {
+			join = fmt.Sprintf("acrossfade=d=%s:c1=tri:c2=tri", formatSeconds(opts.Crossfade))
+		}
+
+		// Both inputs need the same format to be joined
+		pre := strings.Join(append(normalizeFilters(opts.Normalize), "aresample=48000", "aformat=channel_layouts=stereo"), ",")
+		graph := fmt.Sprintf("[0:a]%s[a0];[1:a]%s[a1];[a0][a1]%s,%s[out]", pre, pre, join, strings.Join(post, ","))
+
+		args = append(args, "-filter_complex", graph, "-map", "[out]")
+	} else {
+		// Resample first so rate-changing filters know what they start from
+		filters := post
+		if opts.Filters.Active() || opts.Normalize {
+			filters = append(append(normalizeFilters(opts.Normalize), "aresample=48000"), post...)
+		}
+
+		args = append(args, "-vn", "-af", strings.Join(filters, ","))
+	}
+
+	args = append(args,
+		"-c:a", "libopus",
+		"-b:a", bitrate,
+		"-ar", "48000",
+		"-ac", "2",
+		"-frame_duration", "20",
+		"-application", "audio",
+		"-page_duration", "20000",
+		"-f", "ogg",
+		"pipe:1",
+	)
+
+	return args
+}
+
+// inputArgs returns the options and -i flag to read track from start
+func inputArgs(track *Track, start time.Duration) []string {
+	input := track.URL
+	if track.StreamURL != "" {
+		input = track.StreamURL
+	}
+
+	var args []string
+
+	// Reconnect options are only understood by the http protocol
+	if strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://") {
+		args = append(args, "-reconnect", "1", "-reconnect_streamed", "1", "-reconnect_delay_max", "5")
+	}
+
+	if start > 0 {
+		args = append(args, "-ss", formatSeconds(start))
+	}
+
+	return append(args, "-i", input)
+}
+
+// normalizeFilters returns the EBU R128 loudness filter when enabled.
+// loudnorm upsamples to 192kHz, so it must be followed by a resample.
+func normalizeFilters(enabled bool) []string {
+	if !enabled {
+		return nil
+	}
+	return []string{"loudnorm=I=-16:TP=-1.5:LRA=11"}
+}
+
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+type ffmpegStream struct {
+	cmd     *exec.Cmd
+	stderr  *bytes.Buffer
+	ogg     *oggOpusReader
+	once    sync.Once
+	waitErr error
+}
+
+func (s *ffmpegStream) wait() error {
+	s.once.Do(func() {
+		s.waitErr = s.cmd.Wait()
+	})
+	return s.waitErr
+}
+
+func (s *ffmpegStream) ReadFrame() ([]byte, error) {
+	frame, err := s.ogg.ReadPacket()
+	if err == io.EOF {
+		// Surface ffmpeg failures instead of treating them as a clean end of track
+		if waitErr := s.wait(); waitErr != nil {
+			return nil, fmt.Errorf("ffmpeg failed: %v, output: %s", waitErr, s.stderr.String())
+		}
+	}
+	return frame, err
+}
+
+func (s *ffmpegStream) Close() error {
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	s.wait()
+
+	return nil
+}
+
+// oggOpusReader extracts raw Opus packets from an Ogg container,
+// skipping the OpusHead and OpusTags header packets.
+type oggOpusReader struct {
+	r       io.Reader
+	pending [][]byte
+	partial []byte
+}
+
+func newOggOpusReader(r io.Reader) *oggOpusReader {
+	return &oggOpusReader{r: r}
+}
+
+func (o *oggOpusReader) ReadPacket() ([]byte, error) {
+	for {
+		for len(o.pending) > 0 {
+			packet := o.pending[0]
+			o.pending = o.pending[1:]
+
+			if bytes.HasPrefix(packet, []byte("OpusHead")) || bytes.HasPrefix(packet, []byte("OpusTags")) {
+				continue
+			}
+
+			return packet, nil
+		}
+
+		if err := o.readPage(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (o *oggOpusReader) readPage() error {
+	// Page header: capture pattern (4), version (1), header type (1),
+	// granule position (8), serial (4), sequence (4), checksum (4), segments (1)
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(o.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return io.EOF
+		}
+		return err
+	}
+
+	if string(header[:4]) != "OggS" {
+		return fmt.Errorf("invalid ogg page header")
+	}
+
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(o.r, segments); err != nil {
+		return fmt.Errorf("failed to read ogg segment table: %w", err)
+	}
+
+	size := 0
+	for _, s := range segments {
+		size += int(s)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(o.r, body); err != nil {
+		return fmt.Errorf("failed to read ogg page body: %w", err)
+	}
+
+	// A lacing value below 255 terminates a packet; 255 means it continues
+	offset := 0
+	for _, s := range segments {
+		o.partial = append(o.partial, body[offset:offset+int(s)]...)
+		offset += int(s)
+
+		if s < 255 {
+			o.pending = append(o.pending, o.partial)
+			o.partial = nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package music
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// oggPage builds a single Ogg page around the given packets
+func oggPage(packets ...[]byte) []byte {
+	var segments []byte
+	var body []byte
+	for _, p := range packets {
+		n := len(p)
+		for n >= 255 {
+			segments = append(segments, 255)
+			n -= 255
+		}
+		segments = append(segments, byte(n))
+		body = append(body, p...)
+	}
+
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	header[26] = byte(len(segments))
+
+	page := append(header, segments...)
+	return append(page, body...)
+}
+
+func TestOggOpusReader(t *testing.T) {
+	large := bytes.Repeat([]byte{0x42}, 600)
+
+	var stream []byte
+	stream = append(stream, oggPage([]byte("OpusHead\x01\x02"))...)
+	stream = append(stream, oggPage([]byte("OpusTags"))...)
+	stream = append(stream, oggPage([]byte{1, 2, 3}, large)...)
+	stream = append(stream, oggPage([]byte{4})...)
+
+	reader := newOggOpusReader(bytes.NewReader(stream))
+
+	expected := [][]byte{{1, 2, 3}, large, {4}}
+	for i, want := range expected {
+		packet, err := reader.ReadPacket()
+		if err != nil {
+			t.Fatalf("Unexpected error reading packet %d: %v", i, err)
+		}
+		if !bytes.Equal(packet, want) {
+			t.Errorf("Packet %d: expected %d bytes, got %d", i, len(want), len(packet))
+		}
+	}
+
+	if _, err := reader.ReadPacket(); err != io.EOF {
+		t.Errorf("Expected io.EOF after last packet, got %v", err)
+	}
+}
+
+func TestOggOpusReaderInvalidHeader(t *testing.T) {
+	reader := newOggOpusReader(bytes.NewReader(bytes.Repeat([]byte("x"), 64)))
+
+	if _, err := reader.ReadPacket(); err == nil {
+		t.Error("Expected error for invalid ogg header, got nil")
+	}
+}
+
+func TestFFmpegSourceArgs(t *testing.T) {
+	source := NewFFmpegSource()
+
+	args := source.args(&Track{URL: "https://example.com/song.mp3"}, StreamOptions{Volume: 0.5, Start: 90 * time.Second})
+
+	expected := map[string]string{
+		"-ss":        "90.000",
+		"-i":         "https://example.com/song.mp3",
+		"-af":        "volume=0.50",
+		"-c:a":       "libopus",
+		"-reconnect": "1",
+	}
+	for flag, want := range expected {
+		if got := argValue(args, flag); got != want {
+			t.Errorf("Expected %s to be '%s', got '%s'", flag, want, got)
+		}
+	}
+
+	// Local files must not get http-only options
+	args = source.args(&Track{URL: "/tmp/song.mp3"}, StreamOptions{Volume: 1.0})
+	if argValue(args, "-reconnect") != "" {
+		t.Error("Expected no -reconnect option for local file")
+	}
+	if argValue(args, "-ss") != "" {
+		t.Error("Expected no -ss option when starting from the beginning")
+	}
+
+	// Filters run after resampling and before the volume
+	filters, _, _ := FilterSet{}.TogglePreset("bassboost")
+	args = source.args(&Track{URL: "/tmp/song.mp3"}, StreamOptions{Volume: 1.0, Filters: filters})
+	if got := argValue(args, "-af"); got != "aresample=48000,bass=g=8:f=110:w=0.6,volume=1.00" {
+		t.Errorf("Expected filter chain with bassboost, got '%s'", got)
+	}
+
+	// Loudness normalization comes first and is followed by a resample
+	args = source.args(&Track{URL: "/tmp/song.mp3"}, StreamOptions{Volume: 1.0, Normalize: true})
+	if got := argValue(args, "-af"); got != "loudnorm=I=-16:TP=-1.5:LRA=11,aresample=48000,volume=1.00" {
+		t.Errorf("Expected loudnorm filter chain, got '%s'", got)
+	}
+
+	// Transitions join both inputs in one filter graph
+	args = source.args(&Track{URL: "/tmp/a.mp3"}, StreamOptions{Volume: 1.0, Start: 20 * time.Second, Next: &Track{URL: "/tmp/b.mp3"}, Crossfade: 3 * time.Second})
+	want := "[0:a]aresample=48000,aformat=channel_layouts=stereo[a0];[1:a]aresample=48000,aformat=channel_layouts=stereo[a1];[a0][a1]acrossfade=d=3.000:c1=tri:c2=tri,volume=1.00[out]"
+	if got := argValue(args, "-filter_complex"); got != want {
+		t.Errorf("Expected crossfade filter graph '%s', got '%s'", want, got)
+	}
+	if argValue(args, "-ss") != "20.000" || argValue(args, "-map") != "[out]" || argValue(args, "-af") != "" {
+		t.Errorf("Unexpected transition args: %v", args)
+	}
+
+	// A resolved stream URL takes precedence over the page URL
+	args = source.args(&Track{URL: "https://youtube.com/watch?v=x", StreamURL: "https://cdn.example.com/audio"}, StreamOptions{Volume: 1.0})
+	if got := argValue(args, "-i"); got != "https://cdn.example.com/audio" {
+		t.Errorf("Expected input to be the stream URL, got '%s'", got)
+	}
+}
+
+func argValue(args []string, flag string) string {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestFFmpegSourceLocalFile(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+
+	path := filepath.Join(t.TempDir(), "tone.wav")
+	if err := os.WriteFile(path, silentWAV(time.Second), 0644); err != nil {
+		t.Fatalf("Failed to write test audio file: %v", err)
+	}
+
+	reader, err := NewFFmpegSource().Open(&Track{URL: path}, StreamOptions{Volume: 1.0})
+	if err != nil {
+		t.Fatalf("Failed to open audio stream: %v", err)
+	}
+	defer reader.Close()
+
+	frames := 0
+	for {
+		_, err := reader.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error reading frame: %v", err)
+		}
+		frames++
+	}
+
+	// One second of audio is 50 frames of 20ms, give or take encoder padding
+	if frames < 45 || frames > 55 {
+		t.Errorf("Expected about 50 frames, got %d", frames)
+	}
+}
+
+// silentWAV returns a 48kHz stereo 16-bit PCM WAV file of the given length
+func silentWAV(length time.Duration) []byte {
+	const rate, channels, bits = 48000, 2, 16
+
+	data := make([]byte, int(length.Seconds()*rate)*channels*bits/8)
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(data)))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1))
+	binary.Write(&buf, binary.LittleEndian, uint16(channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(rate))
+	binary.Write(&buf, binary.LittleEndian, uint32(rate*channels*bits/8))
+	binary.Write(&buf, binary.LittleEndian, uint16(channels*bits/8))
+	binary.Write(&buf, binary.LittleEndian, uint16(bits))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+
+	return buf.Bytes()
+}
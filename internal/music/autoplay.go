@@ -0,0 +1,139 @@
+package music
+
+import (
+	"fmt"
+	"strings"
+)
+
+// autoplayCandidates is how many recommendations are asked for at once,
+// leaving room to skip ones that were already played.
+const autoplayCandidates = 10
+
+// Recommender suggests tracks similar to seed, best match first.
+type Recommender interface {
+	Recommend(seed *Track, limit int) ([]*Track, error)
+}
+
+// RecommenderFunc adapts a function to the Recommender interface.
+type RecommenderFunc func(seed *Track, limit int) ([]*Track, error)
+
+func (f RecommenderFunc) Recommend(seed *Track, limit int) ([]*Track, error) {
+	return f(seed, limit)
+}
+
+func (p *Player) SetRecommender(recommender Recommender) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.recommender = recommender
+}
+
+// SetAutoplay toggles queueing a related track whenever the queue runs dry.
+func (p *Player) SetAutoplay(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.autoplay = enabled
+}
+
+func (p *Player) IsAutoplay() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.autoplay
+}
+
+// HasPlayed reports whether track, or one with the same ID or title, has
+// already played since the player was created.
+func (p *Player) HasPlayed(track *Track) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.playedLocked(track)
+}
+
+func (p *Player) playedLocked(track *Track) bool {
+	for _, key := range playedKeys(track) {
+		if p.played[key] {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Player) markPlayedLocked(track *Track) {
+	if p.played == nil {
+		p.played = make(map[string]bool)
+	}
+	for _, key := range playedKeys(track) {
+		p.played[key] = true
+	}
+}
+
+// playedKeys identifies a track by ID or URL, and by title, since the same
+// song is often uploaded more than once
+func playedKeys(track *Track) []string {
+	var keys []string
+	if track.ID != "" {
+		keys = append(keys, "id:"+track.ID)
+	} else if track.URL != "" {
+		keys = append(keys, "url:"+track.URL)
+	}
+	if title := strings.ToLower(strings.TrimSpace(track.Title)); title != "" {
+		keys = append(keys, "title:"+title)
+	}
+	return keys
+}
+
+// autoplayLocked starts looking for a track to follow seed once the queue
+// has run dry. It reports false if autoplay is off or already looking.
+func (p *Player) autoplayLocked(seed *Track) bool {
+	if !p.autoplay || p.recommender == nil || seed == nil || seed.Live || p.autoplaying {
+		return false
+	}
+
+	p.autoplaying = true
+	go p.runAutoplay(seed, p.recommender)
+
+	return true
+}
+
+// runAutoplay asks the recommender for tracks like seed and plays the
+// first one that hasn't been played yet.
+func (p *Player) runAutoplay(seed *Track, recommender Recommender) {
+	defer p.flushEvents()
+
+	tracks, err := recommender.Recommend(seed, autoplayCandidates)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.autoplaying = false
+
+	// Someone queued something while we were looking
+	if p.Current != nil || len(p.Queue) > 0 {
+		return
+	}
+
+	if p.autoplay {
+		for _, track := range tracks {
+			if p.playedLocked(track) {
+				continue
+			}
+
+			track.Autoplay = true
+			if track.ChannelID == "" {
+				track.ChannelID = seed.ChannelID
+			}
+
+			p.Queue = append(p.Queue, track)
+			p.playNextLocked()
+			return
+		}
+	}
+
+	if err != nil {
+		p.emitLocked(Event{Type: EventError, Track: seed, Err: fmt.Errorf("autoplay found nothing to play: %w", err)})
+	}
+	p.emitLocked(Event{Type: EventQueueEmpty, Track: seed})
+}
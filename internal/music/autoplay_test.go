@@ -0,0 +1,115 @@
+package music
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPlayerAutoplay(t *testing.T) {
+	player, sink, _ := newTestPlayer(2)
+
+	var seeds []*Track
+	var mu sync.Mutex
+	player.SetRecommender(RecommenderFunc(func(seed *Track, limit int) ([]*Track, error) {
+		mu.Lock()
+		seeds = append(seeds, seed)
+		mu.Unlock()
+
+		return []*Track{
+			{ID: "a", Title: "Song 1 (Official Video)", URL: "url1-video"},
+			{ID: "b", Title: "song 1", URL: "url1-reupload"}, // Same title as the seed
+			{ID: "c", Title: "Song 2", URL: "url2"},
+		}, nil
+	}))
+	player.SetAutoplay(true)
+
+	events := make(chan Event, 10)
+	player.Subscribe(func(event Event) { events <- event })
+
+	player.ConnectToVoice("guild", "channel")
+	seed := &Track{ID: "seed", Title: "Song 1", URL: "url1", ChannelID: "text"}
+	player.AddToQueue(seed)
+	player.Play()
+
+	receiveFrame(t, sink)
+	receiveFrame(t, sink)
+
+	// The first recommendation that wasn't already played follows
+	frame := receiveFrame(t, sink)
+	if string(frame) != "url1-video" {
+		t.Errorf("Expected autoplay to pick url1-video, got %s", frame)
+	}
+
+	current := player.GetCurrentTrack()
+	if current == nil || !current.Autoplay || current.ChannelID != "text" {
+		t.Errorf("Expected autoplay track in the seed's channel, got %+v", current)
+	}
+
+	receiveFrame(t, sink)
+
+	// url1-reupload shares the seed's title, so Song 2 is next
+	if frame := receiveFrame(t, sink); string(frame) != "url2" {
+		t.Errorf("Expected autoplay to skip the reupload and pick url2, got %s", frame)
+	}
+
+	if !player.HasPlayed(&Track{Title: "SONG 2"}) {
+		t.Error("Expected HasPlayed to match titles case-insensitively")
+	}
+
+	player.SetAutoplay(false)
+	receiveFrame(t, sink)
+
+	waitFor(t, func() bool {
+		for {
+			select {
+			case event := <-events:
+				if event.Type == EventQueueEmpty {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seeds) != 2 || seeds[0] != seed {
+		t.Errorf("Expected 2 recommendations seeded by the last track, got %d", len(seeds))
+	}
+}
+
+func TestPlayerAutoplayNothingFound(t *testing.T) {
+	player, sink, _ := newTestPlayer(1)
+	player.SetRecommender(RecommenderFunc(func(seed *Track, limit int) ([]*Track, error) {
+		return nil, fmt.Errorf("no mix")
+	}))
+	player.SetAutoplay(true)
+
+	events := make(chan Event, 10)
+	player.Subscribe(func(event Event) { events <- event })
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.Play()
+	receiveFrame(t, sink)
+
+	var types []EventType
+	waitFor(t, func() bool {
+		select {
+		case event := <-events:
+			types = append(types, event.Type)
+		default:
+		}
+		return len(types) > 0 && types[len(types)-1] == EventQueueEmpty
+	})
+
+	if len(types) != 4 || types[2] != EventError {
+		t.Errorf("Expected TrackStarted, TrackEnded, Error, QueueEmpty, got %v", types)
+	}
+
+	if player.GetCurrentTrack() != nil {
+		t.Error("Expected nothing to be playing")
+	}
+}
@@ -0,0 +1,42 @@
+package music
+
+type EventType int
+
+const (
+	EventTrackStarted EventType = iota
+	EventTrackEnded
+	EventQueueEmpty
+	EventError
+	EventSegmentSkipped
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventTrackStarted:
+		return "track started"
+	case EventTrackEnded:
+		return "track ended"
+	case EventQueueEmpty:
+		return "queue empty"
+	case EventError:
+		return "error"
+	case EventSegmentSkipped:
+		return "segment skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes something that happened during playback. For
+// EventQueueEmpty, Track is the last track that was played, if any.
+type Event struct {
+	Type    EventType
+	Track   *Track
+	Err     error
+	Segment *Segment // The part of Track jumped over, for EventSegmentSkipped
+}
+
+type EventHandler func(Event)
+
+// GuildEventHandler receives events from every player owned by a Manager
+type GuildEventHandler func(guildID string, event Event)
@@ -0,0 +1,203 @@
+package music
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EqualizerBands are the center frequencies (Hz) of the equalizer bands.
+var EqualizerBands = [10]int{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+// Limits for filter values accepted by FilterSet setters.
+const (
+	MaxEqualizerGain = 12.0 // dB
+	MinSpeed         = 0.5
+	MaxSpeed         = 2.0
+)
+
+// presetFilters maps each named preset to its ffmpeg audio filter.
+// Every chain starts with aresample=48000, so asetrate can rely on the rate.
+var presetFilters = map[string]string{
+	"bassboost": "bass=g=8:f=110:w=0.6",
+	"nightcore": "asetrate=48000*1.25,aresample=48000",
+	"vaporwave": "asetrate=48000*0.8,aresample=48000",
+	"8d":        "apulsator=hz=0.125",
+	"karaoke":   "stereotools=mlev=0.015625",
+}
+
+// presetRates is how much faster presets that resample play the track
+var presetRates = map[string]float64{
+	"nightcore": 1.25,
+	"vaporwave": 0.8,
+}
+
+// Presets returns the names of the available filter presets.
+func Presets() []string {
+	names := make([]string, 0, len(presetFilters))
+	for name := range presetFilters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FilterSet describes the audio effects applied to a player's stream.
+// The zero value applies no effects.
+type FilterSet struct {
+	Presets   []string    `json:"presets,omitempty"` // In the order they were enabled
+	Equalizer [10]float64 `json:"equalizer"`         // Gain in dB for each of EqualizerBands
+	Speed     float64     `json:"speed,omitempty"`   // Tempo multiplier, 0 or 1 is normal
+	Pitch     float64     `json:"pitch,omitempty"`   // Pitch multiplier, 0 or 1 is normal
+}
+
+// HasPreset reports whether the named preset is enabled.
+func (f FilterSet) HasPreset(name string) bool {
+	for _, preset := range f.Presets {
+		if preset == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TogglePreset enables the named preset, or disables it if it was
+// already enabled. Nightcore and vaporwave replace each other.
+func (f FilterSet) TogglePreset(name string) (FilterSet, bool, error) {
+	name = strings.ToLower(name)
+	if _, ok := presetFilters[name]; !ok {
+		return f, false, fmt.Errorf("unknown filter: %s", name)
+	}
+
+	var presets []string
+	enabled := !f.HasPreset(name)
+	for _, preset := range f.Presets {
+		if preset == name {
+			continue
+		}
+		if enabled && presetRates[name] != 0 && presetRates[preset] != 0 {
+			continue
+		}
+		presets = append(presets, preset)
+	}
+	if enabled {
+		presets = append(presets, name)
+	}
+
+	f.Presets = presets
+	return f, enabled, nil
+}
+
+// SetBand sets the gain of equalizer band (1-10) in dB.
+func (f FilterSet) SetBand(band int, gain float64) (FilterSet, error) {
+	if band < 1 || band > len(EqualizerBands) {
+		return f, fmt.Errorf("band must be between 1 and %d", len(EqualizerBands))
+	}
+	if gain < -MaxEqualizerGain || gain > MaxEqualizerGain {
+		return f, fmt.Errorf("gain must be between -%.0f and %.0f dB", MaxEqualizerGain, MaxEqualizerGain)
+	}
+
+	f.Equalizer[band-1] = gain
+	return f, nil
+}
+
+func (f FilterSet) SetSpeed(speed float64) (FilterSet, error) {
+	if speed < MinSpeed || speed > MaxSpeed {
+		return f, fmt.Errorf("speed must be between %.1f and %.1f", MinSpeed, MaxSpeed)
+	}
+
+	f.Speed = speed
+	return f, nil
+}
+
+func (f FilterSet) SetPitch(pitch float64) (FilterSet, error) {
+	if pitch < MinSpeed || pitch > MaxSpeed {
+		return f, fmt.Errorf("pitch must be between %.1f and %.1f", MinSpeed, MaxSpeed)
+	}
+
+	f.Pitch = pitch
+	return f, nil
+}
+
+// Active reports whether any effect is enabled.
+func (f FilterSet) Active() bool {
+	return len(f.Filters()) > 0
+}
+
+// Rate is how many seconds of the track play per second of output.
+func (f FilterSet) Rate() float64 {
+	rate := 1.0
+	if f.Speed > 0 {
+		rate *= f.Speed
+	}
+	for _, preset := range f.Presets {
+		if r, ok := presetRates[preset]; ok {
+			rate *= r
+		}
+	}
+	return rate
+}
+
+// Filters returns the ffmpeg audio filters for the set, in order.
+func (f FilterSet) Filters() []string {
+	var filters []string
+
+	for _, preset := range f.Presets {
+		if filter, ok := presetFilters[preset]; ok {
+			filters = append(filters, filter)
+		}
+	}
+
+	for i, gain := range f.Equalizer {
+		if gain != 0 {
+			filters = append(filters, fmt.Sprintf("equalizer=f=%d:t=o:w=1:g=%.1f", EqualizerBands[i], gain))
+		}
+	}
+
+	// Shift the pitch by resampling, then undo the tempo change it causes
+	if f.Pitch > 0 && f.Pitch != 1 {
+		filters = append(filters,
+			fmt.Sprintf("asetrate=48000*%.2f", f.Pitch),
+			"aresample=48000",
+			fmt.Sprintf("atempo=%.4f", 1/f.Pitch),
+		)
+	}
+
+	if f.Speed > 0 && f.Speed != 1 {
+		filters = append(filters, fmt.Sprintf("atempo=%.2f", f.Speed))
+	}
+
+	return filters
+}
+
+// String describes the enabled effects, e.g. "bassboost, speed 1.25x".
+func (f FilterSet) String() string {
+	parts := append([]string(nil), f.Presets...)
+
+	for i, gain := range f.Equalizer {
+		if gain != 0 {
+			parts = append(parts, fmt.Sprintf("eq %s %+.0fdB", formatFrequency(EqualizerBands[i]), gain))
+		}
+	}
+
+	if f.Speed > 0 && f.Speed != 1 {
+		parts = append(parts, fmt.Sprintf("speed %gx", f.Speed))
+	}
+
+	if f.Pitch > 0 && f.Pitch != 1 {
+		parts = append(parts, fmt.Sprintf("pitch %gx", f.Pitch))
+	}
+
+	if len(parts) == 0 {
+		return "none"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func formatFrequency(hz int) string {
+	if hz >= 1000 {
+		return fmt.Sprintf("%dkHz", hz/1000)
+	}
+	return fmt.Sprintf("%dHz", hz)
+}
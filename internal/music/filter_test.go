@@ -0,0 +1,112 @@
+package music
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterSetTogglePreset(t *testing.T) {
+	var filters FilterSet
+
+	filters, enabled, err := filters.TogglePreset("BassBoost")
+	if err != nil || !enabled || !filters.HasPreset("bassboost") {
+		t.Fatalf("Expected bassboost to be enabled, got %v (enabled %v, err %v)", filters.Presets, enabled, err)
+	}
+
+	filters, _, _ = filters.TogglePreset("nightcore")
+	filters, _, _ = filters.TogglePreset("vaporwave")
+	if filters.HasPreset("nightcore") || !filters.HasPreset("vaporwave") {
+		t.Errorf("Expected vaporwave to replace nightcore, got %v", filters.Presets)
+	}
+
+	filters, enabled, _ = filters.TogglePreset("bassboost")
+	if enabled || filters.HasPreset("bassboost") {
+		t.Errorf("Expected bassboost to be toggled off, got %v", filters.Presets)
+	}
+
+	if _, _, err := filters.TogglePreset("loud"); err == nil {
+		t.Error("Expected error for unknown preset, got nil")
+	}
+}
+
+func TestFilterSetValidation(t *testing.T) {
+	var filters FilterSet
+
+	if _, err := filters.SetSpeed(3); err == nil {
+		t.Error("Expected error for speed above the maximum, got nil")
+	}
+
+	if _, err := filters.SetPitch(0.1); err == nil {
+		t.Error("Expected error for pitch below the minimum, got nil")
+	}
+
+	if _, err := filters.SetBand(11, 3); err == nil {
+		t.Error("Expected error for band out of range, got nil")
+	}
+
+	if _, err := filters.SetBand(1, 20); err == nil {
+		t.Error("Expected error for gain out of range, got nil")
+	}
+}
+
+func TestFilterSetFilters(t *testing.T) {
+	var filters FilterSet
+
+	if filters.Active() || filters.Rate() != 1 || filters.String() != "none" {
+		t.Errorf("Expected zero FilterSet to be inactive, got %v", filters)
+	}
+
+	filters, _, _ = filters.TogglePreset("nightcore")
+	filters, _ = filters.SetBand(1, 6)
+	filters, _ = filters.SetSpeed(1.5)
+	filters, _ = filters.SetPitch(0.8)
+
+	chain := strings.Join(filters.Filters(), ",")
+	for _, want := range []string{"asetrate=48000*1.25", "equalizer=f=31:t=o:w=1:g=6.0", "asetrate=48000*0.80", "atempo=1.2500", "atempo=1.50"} {
+		if !strings.Contains(chain, want) {
+			t.Errorf("Expected filter chain to contain %s, got %s", want, chain)
+		}
+	}
+
+	if rate := filters.Rate(); rate < 1.874 || rate > 1.876 {
+		t.Errorf("Expected rate 1.875, got %v", rate)
+	}
+
+	if got := filters.String(); got != "nightcore, eq 31Hz +6dB, speed 1.5x, pitch 0.8x" {
+		t.Errorf("Unexpected description: %s", got)
+	}
+}
+
+func TestPlayerSetFilters(t *testing.T) {
+	player, sink, source := newTestPlayer(1000)
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1", Duration: 3 * time.Minute})
+	player.Play()
+	receiveFrame(t, sink)
+
+	filters, _ := FilterSet{}.SetSpeed(2)
+	player.SetFilters(filters)
+	receiveFrame(t, sink)
+
+	source.mu.Lock()
+	opts := source.opened[len(source.opened)-1]
+	source.mu.Unlock()
+
+	if opts.Filters.Speed != 2 {
+		t.Errorf("Expected restarted stream to use the new filters, got %+v", opts.Filters)
+	}
+
+	// At double speed each frame covers twice as much of the track
+	before := player.Position()
+	receiveFrame(t, sink)
+	receiveFrame(t, sink)
+	waitFor(t, func() bool { return player.Position()-before >= 4*FrameDuration })
+
+	if player.GetFilters().Speed != 2 {
+		t.Errorf("Expected GetFilters to return the new filters, got %+v", player.GetFilters())
+	}
+
+	player.Stop()
+}
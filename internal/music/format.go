@@ -0,0 +1,71 @@
+package music
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatDuration renders d as m:ss, or h:mm:ss for anything an hour or longer.
+func FormatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	total := int(d.Seconds())
+	hours := total / 3600
+	minutes := (total % 3600) / 60
+	seconds := total % 60
+
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
+
+// ParseTimestamp parses "ss", "mm:ss" or "hh:mm:ss" into a duration.
+func ParseTimestamp(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp: %s", s)
+	}
+
+	total := 0
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid timestamp: %s", s)
+		}
+
+		// Only the leading field may exceed 59
+		if i > 0 && value > 59 {
+			return 0, fmt.Errorf("invalid timestamp: %s", s)
+		}
+
+		total = total*60 + value
+	}
+
+	return time.Duration(total) * time.Second, nil
+}
+
+// ProgressBar draws a text progress bar of width characters, e.g.
+// "▬▬▬▬🔘▬▬▬▬▬". Without a known duration the knob stays at the start.
+func ProgressBar(position, duration time.Duration, width int) string {
+	if width < 1 {
+		width = 1
+	}
+
+	knob := 0
+	if duration > 0 {
+		knob = int(float64(position) / float64(duration) * float64(width-1))
+	}
+	if knob < 0 {
+		knob = 0
+	} else if knob > width-1 {
+		knob = width - 1
+	}
+
+	return strings.Repeat("▬", knob) + "🔘" + strings.Repeat("▬", width-1-knob)
+}
@@ -0,0 +1,62 @@
+package music
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                               "0:00",
+		65 * time.Second:                "1:05",
+		59*time.Minute + 59*time.Second: "59:59",
+		time.Hour + 2*time.Minute + 3*time.Second: "1:02:03",
+	}
+
+	for input, want := range tests {
+		if got := FormatDuration(input); got != want {
+			t.Errorf("Expected %v to format as '%s', got '%s'", input, want, got)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := map[string]time.Duration{
+		"45":      45 * time.Second,
+		"1:30":    90 * time.Second,
+		"75:00":   75 * time.Minute,
+		"1:02:03": time.Hour + 2*time.Minute + 3*time.Second,
+	}
+
+	for input, want := range tests {
+		got, err := ParseTimestamp(input)
+		if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %v", input, err)
+		}
+		if got != want {
+			t.Errorf("Expected '%s' to parse as %v, got %v", input, want, got)
+		}
+	}
+
+	for _, input := range []string{"", "abc", "1:60", "-5", "1:2:3:4"} {
+		if _, err := ParseTimestamp(input); err == nil {
+			t.Errorf("Expected error parsing '%s', got nil", input)
+		}
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	bar := ProgressBar(30*time.Second, time.Minute, 11)
+	if bar != "▬▬▬▬▬🔘▬▬▬▬▬" {
+		t.Errorf("Expected knob in the middle, got '%s'", bar)
+	}
+
+	if bar := ProgressBar(0, 0, 5); !strings.HasPrefix(bar, "🔘") {
+		t.Errorf("Expected knob at the start without a duration, got '%s'", bar)
+	}
+
+	if bar := ProgressBar(2*time.Minute, time.Minute, 5); !strings.HasSuffix(bar, "🔘") {
+		t.Errorf("Expected knob at the end past the duration, got '%s'", bar)
+	}
+}
@@ -0,0 +1,222 @@
+package music
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxHistoryEntries is how many played tracks are kept per guild.
+const MaxHistoryEntries = 1000
+
+// HistoryEntry is one track that started playing in a guild.
+type HistoryEntry struct {
+	Track    *Track    `json:"track"` // Requester is kept, empty for autoplay
+	PlayedAt time.Time `json:"played_at"`
+}
+
+// TrackStat counts how often a track was played.
+type TrackStat struct {
+	Track *Track
+	Plays int
+}
+
+// HistoryStore keeps each guild's listening history as a JSON Lines file
+// in a directory, newest last.
+type HistoryStore struct {
+	Dir string
+
+	mu      sync.Mutex
+	entries map[string][]HistoryEntry // Loaded on first use
+	now     func() time.Time
+}
+
+func NewHistoryStore(dir string) *HistoryStore {
+	return &HistoryStore{
+		Dir:     dir,
+		entries: make(map[string][]HistoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (h *HistoryStore) path(guildID string) string {
+	return filepath.Join(h.Dir, guildID+".jsonl")
+}
+
+// HandleEvent records tracks as they start. Subscribe it to a Manager to
+// keep the history of every guild.
+func (h *HistoryStore) HandleEvent(guildID string, event Event) {
+	if event.Type == EventTrackStarted && event.Track != nil {
+		h.Record(guildID, event.Track)
+	}
+}
+
+// Record adds track to the guild's history as played now.
+func (h *HistoryStore) Record(guildID string, track *Track) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries, err := h.loadLocked(guildID)
+	if err != nil {
+		return err
+	}
+
+	saved := savedTrack(track)
+	saved.Requester = track.Requester
+	entry := HistoryEntry{Track: saved, PlayedAt: h.now()}
+
+	entries = append(entries, entry)
+	if len(entries) > MaxHistoryEntries {
+		// Drop the oldest entries and rewrite the file without them
+		entries = append([]HistoryEntry(nil), entries[len(entries)-MaxHistoryEntries:]...)
+		h.entries[guildID] = entries
+		return h.writeLocked(guildID, entries)
+	}
+	h.entries[guildID] = entries
+
+	return h.appendLocked(guildID, entry)
+}
+
+// Recent returns up to limit of the guild's most recently played tracks,
+// newest first.
+func (h *HistoryStore) Recent(guildID string, limit int) ([]HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries, err := h.loadLocked(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	var recent []HistoryEntry
+	for i := len(entries) - 1; i >= 0 && len(recent) < limit; i-- {
+		recent = append(recent, entries[i])
+	}
+
+	return recent, nil
+}
+
+// Top returns up to limit of the tracks played most often in the guild
+// since the given time, most played first.
+func (h *HistoryStore) Top(guildID string, since time.Time, limit int) ([]TrackStat, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries, err := h.loadLocked(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]*TrackStat)
+	var stats []*TrackStat
+	for _, entry := range entries {
+		if entry.PlayedAt.Before(since) {
+			continue
+		}
+
+		keys := playedKeys(entry.Track)
+		if len(keys) == 0 {
+			continue
+		}
+
+		stat, ok := counts[keys[0]]
+		if !ok {
+			stat = &TrackStat{}
+			counts[keys[0]] = stat
+			stats = append(stats, stat)
+		}
+		stat.Track = entry.Track
+		stat.Plays++
+	}
+
+	// Stable, so ties keep the order they were first played in
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Plays > stats[j].Plays
+	})
+
+	var top []TrackStat
+	for _, stat := range stats {
+		if len(top) == limit {
+			break
+		}
+		top = append(top, *stat)
+	}
+
+	return top, nil
+}
+
+func (h *HistoryStore) loadLocked(guildID string) ([]HistoryEntry, error) {
+	if entries, ok := h.entries[guildID]; ok {
+		return entries, nil
+	}
+
+	data, err := os.ReadFile(h.path(guildID))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	// Skip lines that can't be decoded, such as one cut off by a crash
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Track == nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	h.entries[guildID] = entries
+	return entries, nil
+}
+
+func (h *HistoryStore) appendLocked(guildID string, entry HistoryEntry) error {
+	if err := os.MkdirAll(h.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+
+	file, err := os.OpenFile(h.path(guildID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func (h *HistoryStore) writeLocked(guildID string, entries []HistoryEntry) error {
+	if err := os.MkdirAll(h.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode history: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	// Write to a temporary file first so a crash never loses the history
+	tmp := h.path(guildID) + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	return os.Rename(tmp, h.path(guildID))
+}
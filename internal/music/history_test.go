@@ -0,0 +1,89 @@
+package music
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHistoryStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewHistoryStore(dir)
+
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.HandleEvent("guild1", Event{Type: EventTrackStarted, Track: &Track{ID: "1", Title: "Song 1", URL: "url1", Requester: "user1", ChannelID: "channel"}})
+	now = now.Add(time.Minute)
+	store.HandleEvent("guild1", Event{Type: EventTrackStarted, Track: &Track{ID: "2", Title: "Song 2", URL: "url2"}})
+	store.HandleEvent("guild1", Event{Type: EventTrackEnded, Track: &Track{ID: "3", Title: "Song 3", URL: "url3"}})
+	store.Record("guild2", &Track{ID: "4", Title: "Song 4", URL: "url4"})
+
+	recent, err := store.Recent("guild1", 10)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(recent) != 2 || recent[0].Track.Title != "Song 2" || recent[1].Track.Title != "Song 1" {
+		t.Fatalf("Expected Song 2 then Song 1, got %v", recent)
+	}
+	if recent[1].Track.Requester != "user1" || recent[1].Track.ChannelID != "" {
+		t.Errorf("Expected requester to be kept and channel dropped, got %+v", recent[1].Track)
+	}
+	if !recent[0].PlayedAt.Equal(now) {
+		t.Errorf("Expected PlayedAt to be %v, got %v", now, recent[0].PlayedAt)
+	}
+
+	// A new store reads the history back from disk
+	reloaded, err := NewHistoryStore(dir).Recent("guild1", 1)
+	if err != nil || len(reloaded) != 1 || reloaded[0].Track.Title != "Song 2" {
+		t.Errorf("Expected history to survive a restart, got %v (%v)", reloaded, err)
+	}
+
+	if recent, _ := store.Recent("unknown", 10); len(recent) != 0 {
+		t.Errorf("Expected no history for an unknown guild, got %v", recent)
+	}
+}
+
+func TestHistoryStoreTop(t *testing.T) {
+	store := NewHistoryStore(t.TempDir())
+
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	// Played a long time ago, so it doesn't count
+	store.Record("guild1", &Track{ID: "old", Title: "Old"})
+	store.Record("guild1", &Track{ID: "old", Title: "Old"})
+	store.Record("guild1", &Track{ID: "old", Title: "Old"})
+
+	now = now.Add(30 * 24 * time.Hour)
+	for _, id := range []string{"a", "b", "a", "c", "b", "a"} {
+		store.Record("guild1", &Track{ID: id, Title: "Song " + id})
+	}
+
+	top, err := store.Top("guild1", now.Add(-7*24*time.Hour), 2)
+	if err != nil {
+		t.Fatalf("Failed to get top tracks: %v", err)
+	}
+
+	if len(top) != 2 || top[0].Track.ID != "a" || top[0].Plays != 3 || top[1].Track.ID != "b" || top[1].Plays != 2 {
+		t.Errorf("Expected a (3) and b (2), got %v", top)
+	}
+}
+
+func TestHistoryStoreTrimsOldEntries(t *testing.T) {
+	dir := t.TempDir()
+	store := NewHistoryStore(dir)
+
+	for i := 0; i < MaxHistoryEntries+5; i++ {
+		store.Record("guild1", &Track{ID: fmt.Sprint(i), Title: fmt.Sprintf("Song %d", i)})
+	}
+
+	recent, _ := NewHistoryStore(dir).Recent("guild1", MaxHistoryEntries+5)
+	if len(recent) != MaxHistoryEntries {
+		t.Fatalf("Expected %d entries after trimming, got %d", MaxHistoryEntries, len(recent))
+	}
+
+	if oldest := recent[len(recent)-1].Track.ID; oldest != "5" {
+		t.Errorf("Expected oldest entries to be dropped, oldest kept is %s", oldest)
+	}
+}
@@ -0,0 +1,121 @@
+package music
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MetadataSource watches a live track for changes to what is on air.
+// Watch blocks until stop is closed or the stream ends.
+type MetadataSource interface {
+	Watch(track *Track, stop <-chan struct{}, onTitle func(title string))
+}
+
+// ICYWatcher reads Shoutcast/Icecast in-band metadata. It opens its own
+// connection to the station next to ffmpeg's, since ffmpeg does not pass
+// the metadata through. Streams without ICY support (e.g. HLS) are ignored.
+type ICYWatcher struct {
+	Client *http.Client
+}
+
+func NewICYWatcher() *ICYWatcher {
+	// No timeout: the response body is an endless stream
+	return &ICYWatcher{Client: &http.Client{}}
+}
+
+func (w *ICYWatcher) Watch(track *Track, stop <-chan struct{}, onTitle func(title string)) {
+	url := track.URL
+	if track.StreamURL != "" {
+		url = track.StreamURL
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Icy-MetaData", "1")
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	metaint, err := strconv.Atoi(resp.Header.Get("icy-metaint"))
+	if err != nil || metaint <= 0 {
+		return
+	}
+
+	readICYMetadata(resp.Body, metaint, onTitle)
+}
+
+// readICYMetadata skips over audio data and reports each new StreamTitle.
+// Every metaint bytes of audio are followed by a length byte (in units of
+// 16 bytes) and that many bytes of metadata.
+func readICYMetadata(r io.Reader, metaint int, onTitle func(title string)) error {
+	last := ""
+	length := make([]byte, 1)
+
+	for {
+		if _, err := io.CopyN(io.Discard, r, int64(metaint)); err != nil {
+			return err
+		}
+
+		if _, err := io.ReadFull(r, length); err != nil {
+			return err
+		}
+
+		size := int(length[0]) * 16
+		if size == 0 {
+			continue
+		}
+
+		meta := make([]byte, size)
+		if _, err := io.ReadFull(r, meta); err != nil {
+			return fmt.Errorf("failed to read icy metadata: %w", err)
+		}
+
+		title := parseStreamTitle(string(meta))
+		if title != "" && title != last {
+			last = title
+			onTitle(title)
+		}
+	}
+}
+
+// parseStreamTitle extracts the StreamTitle value from a metadata block
+// such as "StreamTitle='Artist - Song';StreamUrl='http://example.com';"
+func parseStreamTitle(meta string) string {
+	meta = strings.TrimRight(meta, "\x00")
+
+	start := strings.Index(meta, "StreamTitle='")
+	if start < 0 {
+		return ""
+	}
+	meta = meta[start+len("StreamTitle='"):]
+
+	end := strings.Index(meta, "';")
+	if end < 0 {
+		end = strings.LastIndex(meta, "'")
+	}
+	if end < 0 {
+		return strings.TrimSpace(meta)
+	}
+
+	return strings.TrimSpace(meta[:end])
+}
@@ -0,0 +1,65 @@
+package music
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// icyBlock encodes metadata as it appears in an ICY stream, padded to
+// a multiple of 16 bytes and prefixed with its length.
+func icyBlock(meta string) []byte {
+	size := (len(meta) + 15) / 16
+	block := make([]byte, 1+size*16)
+	block[0] = byte(size)
+	copy(block[1:], meta)
+	return block
+}
+
+func TestReadICYMetadata(t *testing.T) {
+	const metaint = 8
+	audio := bytes.Repeat([]byte{0xff}, metaint)
+
+	var stream bytes.Buffer
+	stream.Write(audio)
+	stream.Write(icyBlock("StreamTitle='Artist - First';StreamUrl='';"))
+	stream.Write(audio)
+	stream.Write([]byte{0}) // No metadata change
+	stream.Write(audio)
+	stream.Write(icyBlock("StreamTitle='Artist - First';"))
+	stream.Write(audio)
+	stream.Write(icyBlock("StreamTitle='Artist - Second';"))
+	stream.Write(audio[:3])
+
+	var titles []string
+	err := readICYMetadata(&stream, metaint, func(title string) {
+		titles = append(titles, title)
+	})
+
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected stream to end with EOF, got %v", err)
+	}
+
+	if len(titles) != 2 || titles[0] != "Artist - First" || titles[1] != "Artist - Second" {
+		t.Errorf("Expected titles [Artist - First, Artist - Second], got %v", titles)
+	}
+}
+
+func TestParseStreamTitle(t *testing.T) {
+	tests := []struct {
+		meta string
+		want string
+	}{
+		{"StreamTitle='Artist - Song';StreamUrl='http://example.com';", "Artist - Song"},
+		{"StreamTitle='It's a song';\x00\x00\x00", "It's a song"},
+		{"StreamTitle='Unterminated'\x00\x00", "Unterminated"},
+		{"StreamTitle='';", ""},
+		{"StreamUrl='http://example.com';", ""},
+	}
+
+	for _, test := range tests {
+		if got := parseStreamTitle(test.meta); got != test.want {
+			t.Errorf("Expected parseStreamTitle(%q) to be %q, got %q", test.meta, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package music
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+type LoopMode int
+
+const (
+	LoopOff LoopMode = iota
+	LoopTrack
+	LoopQueue
+)
+
+func (m LoopMode) String() string {
+	switch m {
+	case LoopTrack:
+		return "track"
+	case LoopQueue:
+		return "queue"
+	default:
+		return "off"
+	}
+}
+
+// ParseLoopMode accepts the names used by the /loop command
+func ParseLoopMode(s string) (LoopMode, error) {
+	switch strings.ToLower(s) {
+	case "off", "none":
+		return LoopOff, nil
+	case "track", "one", "song":
+		return LoopTrack, nil
+	case "queue", "all":
+		return LoopQueue, nil
+	default:
+		return LoopOff, fmt.Errorf("unknown loop mode: %s", s)
+	}
+}
+
+// Next cycles off -> track -> queue -> off
+func (m LoopMode) Next() LoopMode {
+	return (m + 1) % 3
+}
+
+func (p *Player) SetLoopMode(mode LoopMode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.loop = mode
+}
+
+func (p *Player) GetLoopMode() LoopMode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.loop
+}
+
+// Shuffle randomizes the queue. The order from before the first shuffle is
+// kept so Unshuffle can restore it.
+func (p *Player) Shuffle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.unshuffled == nil {
+		p.unshuffled = make([]*Track, len(p.Queue))
+		copy(p.unshuffled, p.Queue)
+	}
+
+	rand.Shuffle(len(p.Queue), func(i, j int) {
+		p.Queue[i], p.Queue[j] = p.Queue[j], p.Queue[i]
+	})
+}
+
+// Unshuffle puts the queue back in the order it had before Shuffle.
+// Tracks added since then keep their relative order at the end.
+func (p *Player) Unshuffle() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.unshuffled == nil {
+		return fmt.Errorf("queue is not shuffled")
+	}
+
+	remaining := make(map[*Track]int, len(p.Queue))
+	for _, track := range p.Queue {
+		remaining[track]++
+	}
+
+	restored := make([]*Track, 0, len(p.Queue))
+	for _, track := range p.unshuffled {
+		if remaining[track] > 0 {
+			restored = append(restored, track)
+			remaining[track]--
+		}
+	}
+	for _, track := range p.Queue {
+		if remaining[track] > 0 {
+			restored = append(restored, track)
+			remaining[track]--
+		}
+	}
+
+	p.Queue = restored
+	p.unshuffled = nil
+
+	return nil
+}
+
+func (p *Player) IsShuffled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.unshuffled != nil
+}
+
+// advanceLocked moves past finished according to the loop mode and starts
+// whatever comes next. Skipped tracks are never repeated by LoopTrack.
+func (p *Player) advanceLocked(finished *Track, skipped bool) error {
+	p.requeueLocked(finished, skipped)
+	return p.playNextLocked()
+}
+
+// requeueLocked puts finished back into the queue as the loop mode asks
+func (p *Player) requeueLocked(finished *Track, skipped bool) {
+	if finished == nil {
+		return
+	}
+
+	switch p.loop {
+	case LoopTrack:
+		if !skipped {
+			p.Queue = append([]*Track{finished}, p.Queue...)
+		}
+	case LoopQueue:
+		p.Queue = append(p.Queue, finished)
+	}
+}
+
+// peekNextLocked returns the track that will play once finished ends on
+// its own, or nil if playback would stop.
+func (p *Player) peekNextLocked(finished *Track) *Track {
+	switch {
+	case p.loop == LoopTrack:
+		return finished
+	case len(p.Queue) > 0:
+		return p.Queue[0]
+	case p.loop == LoopQueue:
+		return finished
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package music
+
+import (
+	"testing"
+)
+
+func TestParseLoopMode(t *testing.T) {
+	tests := map[string]LoopMode{
+		"off":   LoopOff,
+		"track": LoopTrack,
+		"One":   LoopTrack,
+		"queue": LoopQueue,
+		"all":   LoopQueue,
+	}
+
+	for input, want := range tests {
+		got, err := ParseLoopMode(input)
+		if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %v", input, err)
+		}
+		if got != want {
+			t.Errorf("Expected '%s' to parse as %v, got %v", input, want, got)
+		}
+	}
+
+	if _, err := ParseLoopMode("sideways"); err == nil {
+		t.Error("Expected error for unknown loop mode, got nil")
+	}
+
+	if LoopQueue.Next() != LoopOff {
+		t.Errorf("Expected queue loop to cycle back to off, got %v", LoopQueue.Next())
+	}
+}
+
+func TestLoopTrackRepeatsCurrent(t *testing.T) {
+	player, sink, _ := newTestPlayer(1)
+	player.SetLoopMode(LoopTrack)
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.AddToQueue(&Track{Title: "Song 2", URL: "url2"})
+	player.Play()
+
+	for i := 0; i < 3; i++ {
+		if frame := receiveFrame(t, sink); string(frame) != "url1" {
+			t.Errorf("Expected repeated frame from 'url1', got '%s'", frame)
+		}
+	}
+
+	// Skipping leaves the repeated track behind
+	player.Skip()
+	waitFor(t, func() bool { return string(receiveFrame(t, sink)) == "url2" })
+
+	player.Stop()
+}
+
+func TestLoopQueueRequeuesTracks(t *testing.T) {
+	player, sink, _ := newTestPlayer(1)
+	player.SetLoopMode(LoopQueue)
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.AddToQueue(&Track{Title: "Song 2", URL: "url2"})
+	player.Play()
+
+	expected := []string{"url1", "url2", "url1", "url2"}
+	for _, want := range expected {
+		if frame := receiveFrame(t, sink); string(frame) != want {
+			t.Errorf("Expected frame from '%s', got '%s'", want, frame)
+		}
+	}
+
+	player.Stop()
+}
+
+func TestShuffleAndUnshuffle(t *testing.T) {
+	player := NewPlayer()
+
+	var tracks []*Track
+	for i := 0; i < 20; i++ {
+		track := &Track{Title: string(rune('a' + i))}
+		tracks = append(tracks, track)
+		player.AddToQueue(track)
+	}
+
+	if err := player.Unshuffle(); err == nil {
+		t.Error("Expected error unshuffling an unshuffled queue, got nil")
+	}
+
+	player.Shuffle()
+
+	if !player.IsShuffled() {
+		t.Error("Expected queue to be marked as shuffled")
+	}
+
+	if player.GetQueueLength() != len(tracks) {
+		t.Fatalf("Expected shuffle to keep %d tracks, got %d", len(tracks), player.GetQueueLength())
+	}
+
+	// Changes made while shuffled survive the restore
+	player.RemoveFromQueue(0)
+	added := &Track{Title: "added"}
+	player.AddToQueue(added)
+
+	if err := player.Unshuffle(); err != nil {
+		t.Fatalf("Failed to unshuffle: %v", err)
+	}
+
+	queue := player.GetQueue()
+	if queue[len(queue)-1] != added {
+		t.Error("Expected track added while shuffled to be last")
+	}
+
+	last := -1
+	for _, track := range queue[:len(queue)-1] {
+		index := -1
+		for i, original := range tracks {
+			if original == track {
+				index = i
+			}
+		}
+		if index <= last {
+			t.Fatalf("Expected original order to be restored, '%s' is out of place", track.Title)
+		}
+		last = index
+	}
+}
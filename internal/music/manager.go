@@ -0,0 +1,422 @@
+package music
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultIdleTimeout is how long a guild's player may sit with nothing
+// playing and nothing queued before the manager tears it down.
+const DefaultIdleTimeout = 5 * time.Minute
+
+// DefaultEmptyGrace is how long a player stays paused in a voice channel
+// everyone has left, waiting for someone to come back.
+const DefaultEmptyGrace = time.Minute
+
+// Manager owns one Player per guild, creating them on demand.
+type Manager struct {
+	mu            sync.Mutex
+	players       map[string]*Player
+	idleSince     map[string]time.Time
+	emptySince    map[string]time.Time
+	autoPaused    map[string]bool
+	connector     VoiceConnector
+	source        AudioSource
+	idleTimeout   time.Duration
+	emptyGrace    time.Duration
+	now           func() time.Time
+	done          chan struct{}
+	handlers      []GuildEventHandler
+	store         *StateStore
+	recommender   Recommender
+	segments      SegmentSource
+	resolver      StreamResolver
+	settings      map[string]GuildSettings // Loaded or changed so far, see settingsLocked
+	settingsStore *SettingsStore
+}
+
+func NewManager(connector VoiceConnector, source AudioSource, idleTimeout time.Duration) *Manager {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+
+	return &Manager{
+		players:     make(map[string]*Player),
+		idleSince:   make(map[string]time.Time),
+		emptySince:  make(map[string]time.Time),
+		autoPaused:  make(map[string]bool),
+		settings:    make(map[string]GuildSettings),
+		connector:   connector,
+		source:      source,
+		idleTimeout: idleTimeout,
+		emptyGrace:  DefaultEmptyGrace,
+		now:         time.Now,
+	}
+}
+
+// Get returns the guild's player, creating it if needed.
+func (m *Manager) Get(guildID string) *Player {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	player, ok := m.players[guildID]
+	if !ok {
+		player = NewVoicePlayer(m.connector, m.source)
+		player.SetRecommender(m.recommender)
+		player.SetSegmentSource(m.segments)
+		player.SetStreamResolver(m.resolver)
+		player.applySettings(m.settingsLocked(guildID))
+		for _, handler := range m.handlers {
+			player.Subscribe(guildHandler(guildID, handler))
+		}
+		m.players[guildID] = player
+	}
+
+	return player
+}
+
+// Subscribe registers handler for events from all current and future players.
+func (m *Manager) Subscribe(handler GuildEventHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlers = append(m.handlers, handler)
+	for guildID, player := range m.players {
+		player.Subscribe(guildHandler(guildID, handler))
+	}
+}
+
+func guildHandler(guildID string, handler GuildEventHandler) EventHandler {
+	return func(event Event) {
+		handler(guildID, event)
+	}
+}
+
+// SetRecommender sets where current and future players find tracks for
+// autoplay.
+func (m *Manager) SetRecommender(recommender Recommender) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.recommender = recommender
+	for _, player := range m.players {
+		player.SetRecommender(recommender)
+	}
+}
+
+// SetStreamResolver sets how current and future players look up the
+// stream URL of tracks that don't have one.
+func (m *Manager) SetStreamResolver(resolver StreamResolver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.resolver = resolver
+	for _, player := range m.players {
+		player.SetStreamResolver(resolver)
+	}
+}
+
+// SetSegmentSource sets where current and future players look up the
+// parts of tracks to skip.
+func (m *Manager) SetSegmentSource(source SegmentSource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.segments = source
+	for _, player := range m.players {
+		player.SetSegmentSource(source)
+	}
+}
+
+// SetSettingsStore makes the manager keep guild settings in store, so
+// they survive restarts. Call it before any player is created.
+func (m *Manager) SetSettingsStore(store *SettingsStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.settingsStore = store
+}
+
+// Settings returns the guild's settings, whether or not it has a player.
+func (m *Manager) Settings(guildID string) GuildSettings {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.settingsLocked(guildID)
+}
+
+func (m *Manager) settingsLocked(guildID string) GuildSettings {
+	settings, ok := m.settings[guildID]
+	if !ok && m.settingsStore != nil {
+		// Unreadable settings fall back to the defaults
+		settings, _ = m.settingsStore.Get(guildID)
+		m.settings[guildID] = settings
+	}
+
+	return settings
+}
+
+// UpdateSettings changes the guild's settings with update, saves them and
+// applies them to the guild's player if it has one, without creating
+// one. Invalid settings are refused; otherwise they are changed even if
+// saving them or restarting the stream fails.
+func (m *Manager) UpdateSettings(guildID string, update func(settings *GuildSettings)) error {
+	m.mu.Lock()
+	settings := m.settingsLocked(guildID)
+	update(&settings)
+	if err := settings.Transition.validate(); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.settings[guildID] = settings
+	store := m.settingsStore
+	player, ok := m.players[guildID]
+	m.mu.Unlock()
+
+	var err error
+	if store != nil {
+		err = store.Save(guildID, settings)
+	}
+	if ok {
+		if applyErr := player.applySettings(settings); applyErr != nil && err == nil {
+			err = applyErr
+		}
+	}
+
+	return err
+}
+
+// Lookup returns the guild's player without creating one.
+func (m *Manager) Lookup(guildID string) (*Player, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	player, ok := m.players[guildID]
+	return player, ok
+}
+
+// Remove stops the guild's player, leaves voice and forgets it,
+// including any saved state.
+func (m *Manager) Remove(guildID string) {
+	if m.disconnect(guildID) && m.store != nil {
+		m.store.Delete(guildID)
+	}
+}
+
+func (m *Manager) disconnect(guildID string) bool {
+	m.mu.Lock()
+	player, ok := m.players[guildID]
+	delete(m.players, guildID)
+	delete(m.idleSince, guildID)
+	delete(m.emptySince, guildID)
+	delete(m.autoPaused, guildID)
+	m.mu.Unlock()
+
+	if ok {
+		player.Stop()
+		player.DisconnectFromVoice()
+	}
+
+	return ok
+}
+
+// SetEmptyGrace sets how long a player waits for someone to rejoin its
+// voice channel before leaving. Zero leaves as soon as it empties.
+func (m *Manager) SetEmptyGrace(grace time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if grace < 0 {
+		grace = 0
+	}
+	m.emptyGrace = grace
+}
+
+// ListenersChanged tells the manager how many people are left listening
+// to the guild's player. When the channel empties the player is paused,
+// and it resumes if someone comes back before the grace period is over.
+// It reports whether the player was removed.
+func (m *Manager) ListenersChanged(guildID string, listeners int) bool {
+	m.mu.Lock()
+	player, ok := m.players[guildID]
+	if !ok {
+		m.mu.Unlock()
+		return false
+	}
+
+	if listeners > 0 {
+		_, wasEmpty := m.emptySince[guildID]
+		resume := m.autoPaused[guildID]
+		delete(m.emptySince, guildID)
+		delete(m.autoPaused, guildID)
+		m.mu.Unlock()
+
+		// Only resume playback we paused, not one a listener paused
+		if wasEmpty && resume {
+			player.Resume()
+		}
+		return false
+	}
+
+	if m.emptyGrace == 0 {
+		m.mu.Unlock()
+		m.Remove(guildID)
+		return true
+	}
+
+	if _, ok := m.emptySince[guildID]; ok {
+		m.mu.Unlock()
+		return false
+	}
+
+	m.emptySince[guildID] = m.now()
+	if player.IsPlaying() {
+		player.Pause()
+		m.autoPaused[guildID] = true
+	}
+	m.mu.Unlock()
+
+	return false
+}
+
+// SetStore makes the manager save every player's state to store
+// periodically and on Close. Call it before Start.
+func (m *Manager) SetStore(store *StateStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.store = store
+}
+
+// Restore creates the guild's player from a saved state. The player
+// only starts streaming once it is connected to voice.
+func (m *Manager) Restore(guildID string, state PlayerState) *Player {
+	player := m.Get(guildID)
+	player.Restore(state)
+
+	return player
+}
+
+// Save writes the state of every player to the store. Players with
+// nothing queued have their saved state removed.
+func (m *Manager) Save() error {
+	if m.store == nil {
+		return nil
+	}
+
+	var firstErr error
+	for _, guildID := range m.Guilds() {
+		player, ok := m.Lookup(guildID)
+		if !ok {
+			continue
+		}
+
+		state := player.Snapshot()
+
+		var err error
+		if state.Empty() {
+			err = m.store.Delete(guildID)
+		} else {
+			err = m.store.Save(guildID, state)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (m *Manager) Guilds() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	guilds := make([]string, 0, len(m.players))
+	for guildID := range m.players {
+		guilds = append(guilds, guildID)
+	}
+
+	return guilds
+}
+
+// ReapIdle tears down players that have been idle for longer than the
+// idle timeout, or left alone in their channel for longer than the grace
+// period, and returns the guilds that were removed.
+func (m *Manager) ReapIdle() []string {
+	now := m.now()
+
+	m.mu.Lock()
+	var expired []string
+	for guildID, player := range m.players {
+		if since, ok := m.emptySince[guildID]; ok && now.Sub(since) >= m.emptyGrace {
+			expired = append(expired, guildID)
+			continue
+		}
+
+		if !player.IsIdle() {
+			delete(m.idleSince, guildID)
+			continue
+		}
+
+		since, ok := m.idleSince[guildID]
+		if !ok {
+			m.idleSince[guildID] = now
+			continue
+		}
+
+		if now.Sub(since) >= m.idleTimeout {
+			expired = append(expired, guildID)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, guildID := range expired {
+		m.Remove(guildID)
+	}
+
+	return expired
+}
+
+// Start reaps idle players in the background until Close is called.
+func (m *Manager) Start(interval time.Duration) {
+	m.mu.Lock()
+	if m.done != nil {
+		m.mu.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	m.done = done
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.ReapIdle()
+				m.Save()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the reaper, saves every player's state and disconnects
+// them. Saved state is kept so the next start can restore it.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	if m.done != nil {
+		close(m.done)
+		m.done = nil
+	}
+	m.mu.Unlock()
+
+	m.Save()
+
+	for _, guildID := range m.Guilds() {
+		m.disconnect(guildID)
+	}
+}
@@ -0,0 +1,199 @@
+package music
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManagerGetCreatesPerGuildPlayers(t *testing.T) {
+	manager := NewManager(nil, &fakeSource{}, time.Minute)
+
+	first := manager.Get("guild1")
+	second := manager.Get("guild2")
+
+	if first == second {
+		t.Error("Expected different guilds to get different players")
+	}
+
+	if manager.Get("guild1") != first {
+		t.Error("Expected Get to return the existing player for a guild")
+	}
+
+	first.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	if second.GetQueueLength() != 0 {
+		t.Errorf("Expected other guild's queue to be empty, got length %d", second.GetQueueLength())
+	}
+
+	if len(manager.Guilds()) != 2 {
+		t.Errorf("Expected 2 guilds, got %d", len(manager.Guilds()))
+	}
+}
+
+func TestManagerLookupAndRemove(t *testing.T) {
+	manager := NewManager(nil, &fakeSource{}, time.Minute)
+
+	if _, ok := manager.Lookup("guild1"); ok {
+		t.Error("Expected Lookup not to create a player")
+	}
+
+	player := manager.Get("guild1")
+	player.ConnectToVoice("guild1", "channel")
+
+	manager.Remove("guild1")
+
+	if _, ok := manager.Lookup("guild1"); ok {
+		t.Error("Expected player to be removed")
+	}
+
+	if player.IsConnectedToVoice() {
+		t.Error("Expected removed player to leave voice")
+	}
+}
+
+func TestManagerReapIdle(t *testing.T) {
+	manager := NewManager(nil, &fakeSource{}, time.Minute)
+
+	now := time.Now()
+	manager.now = func() time.Time { return now }
+
+	manager.Get("idle")
+	busy := manager.Get("busy")
+	busy.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+
+	// The first pass only notes when each player went idle
+	if reaped := manager.ReapIdle(); len(reaped) != 0 {
+		t.Errorf("Expected nothing reaped on first pass, got %v", reaped)
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	reaped := manager.ReapIdle()
+	if len(reaped) != 1 || reaped[0] != "idle" {
+		t.Errorf("Expected only 'idle' to be reaped, got %v", reaped)
+	}
+
+	if _, ok := manager.Lookup("busy"); !ok {
+		t.Error("Expected busy player to be kept")
+	}
+}
+
+func TestManagerListenersChanged(t *testing.T) {
+	manager := NewManager(nil, &fakeSource{}, time.Minute)
+	manager.SetEmptyGrace(time.Minute)
+
+	now := time.Now()
+	manager.now = func() time.Time { return now }
+
+	player := manager.Get("guild1")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.Play()
+
+	// Everyone left, so playback pauses
+	if manager.ListenersChanged("guild1", 0) {
+		t.Error("Expected player to be kept during the grace period")
+	}
+	if player.IsPlaying() {
+		t.Error("Expected player to pause when the channel empties")
+	}
+
+	// Someone came back in time
+	now = now.Add(30 * time.Second)
+	manager.ListenersChanged("guild1", 1)
+	if !player.IsPlaying() {
+		t.Error("Expected player to resume when someone rejoins")
+	}
+
+	// A player paused by a listener stays paused
+	player.Pause()
+	manager.ListenersChanged("guild1", 0)
+	manager.ListenersChanged("guild1", 2)
+	if player.IsPlaying() {
+		t.Error("Expected player paused by a listener to stay paused")
+	}
+
+	// Nobody came back before the grace period ran out
+	manager.ListenersChanged("guild1", 0)
+	if reaped := manager.ReapIdle(); len(reaped) != 0 {
+		t.Errorf("Expected nothing reaped during the grace period, got %v", reaped)
+	}
+
+	now = now.Add(time.Minute)
+
+	if reaped := manager.ReapIdle(); len(reaped) != 1 || reaped[0] != "guild1" {
+		t.Errorf("Expected 'guild1' to be reaped after the grace period, got %v", reaped)
+	}
+
+	// Unknown guilds are ignored
+	if manager.ListenersChanged("guild2", 0) {
+		t.Error("Expected no player to be removed for an unknown guild")
+	}
+	if _, ok := manager.Lookup("guild2"); ok {
+		t.Error("Expected ListenersChanged not to create a player")
+	}
+}
+
+func TestManagerListenersChangedWithoutGrace(t *testing.T) {
+	manager := NewManager(nil, &fakeSource{}, time.Minute)
+	manager.SetEmptyGrace(0)
+
+	manager.Get("guild1").AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+
+	if !manager.ListenersChanged("guild1", 0) {
+		t.Error("Expected player to be removed once the channel empties")
+	}
+	if _, ok := manager.Lookup("guild1"); ok {
+		t.Error("Expected player to be removed")
+	}
+}
+
+func TestManagerSubscribeTagsGuild(t *testing.T) {
+	manager := NewManager(nil, &fakeSource{}, time.Minute)
+
+	existing := manager.Get("guild1")
+
+	var guilds []string
+	manager.Subscribe(func(guildID string, e Event) {
+		guilds = append(guilds, guildID)
+	})
+
+	created := manager.Get("guild2")
+
+	existing.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	existing.Play()
+	created.AddToQueue(&Track{Title: "Song 2", URL: "url2"})
+	created.Play()
+
+	if len(guilds) != 2 || guilds[0] != "guild1" || guilds[1] != "guild2" {
+		t.Errorf("Expected events from guild1 then guild2, got %v", guilds)
+	}
+}
+
+func TestManagerSaveAndClose(t *testing.T) {
+	manager := NewManager(nil, &fakeSource{}, time.Minute)
+	store := NewStateStore(t.TempDir())
+	manager.SetStore(store)
+
+	manager.Get("queued").AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	manager.Get("empty")
+	manager.Get("removed").AddToQueue(&Track{Title: "Song 2", URL: "url2"})
+	store.Save("empty", PlayerState{Queue: []*Track{{URL: "stale"}}})
+
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	manager.Remove("removed")
+
+	states, _ := store.Load()
+	if len(states) != 1 || len(states["queued"].Queue) != 1 {
+		t.Errorf("Expected only the queued guild to be saved, got %v", states)
+	}
+
+	// Close keeps saved state for the next start
+	manager.Close()
+
+	states, _ = store.Load()
+	if len(states) != 1 {
+		t.Errorf("Expected state to survive Close, got %d states", len(states))
+	}
+}
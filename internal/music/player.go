@@ -1,11 +1,16 @@
 package music
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 )
 
+// ErrNotAllowed is returned by RemoveIf when the check refuses the track.
+var ErrNotAllowed = errors.New("not allowed")
+
 type Track struct {
 	ID       string
 	Title    string
@@ -13,32 +18,106 @@ type Track struct {
 	Duration time.Duration
 	Thumbnail string
 	Uploader string
+	StreamURL string `json:"-"` // Direct media URL for ffmpeg, falls back to URL. Expires, so never saved
+	Live      bool   // Radio or other live stream without a fixed Duration
+	Requester string // User ID of whoever queued the track
+	ChannelID string // Text channel the track was requested from
+	Autoplay  bool   // Picked by autoplay rather than requested
 }
 
 type Player struct {
-	Queue     []*Track
-	Playing   bool
-	Current   *Track
-	mu        sync.Mutex
-	volume    float64
-	voiceConn *VoiceConnection
+	Queue      []*Track
+	Playing    bool
+	Current    *Track
+	mu         sync.Mutex
+	cond       *sync.Cond
+	volume     float64
+	voiceConn  *VoiceConnection
+	connector  VoiceConnector
+	source     AudioSource
+	resolver   StreamResolver
+	resolving  *Track // Track whose stream URL is being looked up, see resolve.go
+	stream     *playback
+	handlers   []EventHandler
+	pending    []Event
+	loop       LoopMode
+	unshuffled []*Track // Queue order before Shuffle, nil when not shuffled
+	metadata   MetadataSource
+	title      string          // What a live track currently has on air
+	resumeAt   time.Duration   // Where Current starts once a stream opens, set by Restore
+	skipVotes  map[string]bool // Users who voted to skip Current
+	filters    FilterSet
+	normalize  bool
+	transition Transition
+	
+	recommender Recommender
+	autoplay    bool
+	autoplaying bool            // A recommendation is being looked up
+	played      map[string]bool // Keys of tracks played this session, see playedKeys
+	
+	segmentSource SegmentSource
+	skipSegments  bool      // Segments are only skipped once turned on
+	segmentsFor   *Track    // Track the segments were looked up for
+	segments      []Segment // Parts of segmentsFor to skip, see segments.go
 }
 
-// VoiceConnection is a mock type representing a voice connection
-// In a real implementation, this would interface with DiscordGo's voice connection
+// VoiceConnection tracks the voice channel the player is attached to.
+// The sink is nil until a VoiceConnector has actually joined the channel.
 type VoiceConnection struct {
+	GuildID   string
 	ChannelID string
 	Connected bool
+	sink      VoiceSink
+}
+
+// playback is a single live stream of the current track into the voice sink
+type playback struct {
+	track    *Track
+	reader   FrameReader
+	offset   time.Duration
+	frames   int
+	paused   bool
+	stopped  bool
+	rate     float64       // Seconds of track played per frame second
+	metaStop chan struct{} // Closed to stop watching live stream metadata
+	
+	// Transitions into the next track, see transition.go
+	next     *Track        // Track this stream leads into, nil once it has
+	switchAt time.Duration // Position in track where next begins
+	handoff  *playback     // Prepared stream to hand over to
+	prepared bool          // A handoff was already attempted
 }
 
 func NewPlayer() *Player {
-	return &Player{
+	return NewVoicePlayer(nil, NewFFmpegSource())
+}
+
+// NewVoicePlayer creates a player that joins voice through connector and
+// renders tracks with source. A nil connector keeps the player offline,
+// which is what NewPlayer does.
+func NewVoicePlayer(connector VoiceConnector, source AudioSource) *Player {
+	p := &Player{
 		Queue:  make([]*Track, 0),
 		volume: 1.0, // 100% volume
 		voiceConn: &VoiceConnection{
 			Connected: false,
 		},
+		connector: connector,
+		source:    source,
+		metadata:  NewICYWatcher(),
 	}
+	p.cond = sync.NewCond(&p.mu)
+
+	return p
+}
+
+// Subscribe registers handler to receive player events. Handlers run
+// outside the player lock, so they may call back into the player.
+func (p *Player) Subscribe(handler EventHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	p.handlers = append(p.handlers, handler)
 }
 
 func (p *Player) AddToQueue(track *Track) {
@@ -48,7 +127,16 @@ func (p *Player) AddToQueue(track *Track) {
 	p.Queue = append(p.Queue, track)
 }
 
+// AddNext queues track to play right after the current one.
+func (p *Player) AddNext(track *Track) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	p.Queue = append([]*Track{track}, p.Queue...)
+}
+
 func (p *Player) Play() error {
+	defer p.flushEvents()
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
@@ -57,20 +145,17 @@ func (p *Player) Play() error {
 		return nil
 	}
 	
+	// A paused track picks up where it left off
+	if p.Current != nil {
+		p.resumeLocked()
+		return nil
+	}
+	
 	if len(p.Queue) == 0 {
 		return fmt.Errorf("queue is empty")
 	}
 	
-	p.Current = p.Queue[0]
-	p.Queue = p.Queue[1:]
-	p.Playing = true
-	
-	// In a real implementation, this would:
-	// 1. Connect to voice channel
-	// 2. Stream the audio from URL
-	// 3. Handle playback controls
-	
-	return nil
+	return p.playNextLocked()
 }
 
 func (p *Player) Pause() {
@@ -78,14 +163,34 @@ func (p *Player) Pause() {
 	defer p.mu.Unlock()
 	
 	p.Playing = false
+	if p.stream != nil {
+		p.stream.paused = true
+	}
 }
 
 func (p *Player) Resume() {
+	defer p.flushEvents()
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
-	if p.Current != nil {
-		p.Playing = true
+	p.resumeLocked()
+}
+
+func (p *Player) resumeLocked() {
+	if p.Current == nil {
+		return
+	}
+	
+	p.Playing = true
+	if p.stream != nil {
+		p.stream.paused = false
+		p.cond.Broadcast()
+		return
+	}
+	
+	// Nothing was streaming yet, e.g. the player connected after Play
+	if err := p.startLocked(p.Current, p.resumeAt); err != nil {
+		p.emitLocked(Event{Type: EventError, Track: p.Current, Err: err})
 	}
 }
 
@@ -93,28 +198,62 @@ func (p *Player) Stop() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
+	p.stopLocked()
 	p.Playing = false
 	p.Current = nil
 	p.Queue = make([]*Track, 0)
+	p.unshuffled = nil
+	p.resumeAt = 0
+	p.skipVotes = nil
 }
 
 func (p *Player) Skip() error {
+	defer p.flushEvents()
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
-	if len(p.Queue) > 0 {
-		p.Current = p.Queue[0]
-		p.Queue = p.Queue[1:]
-		return nil
+	return p.skipLocked()
+}
+
+// SkipTo skips ahead to the track at index in the queue, dropping the
+// tracks before it. With LoopQueue they go to the back of the queue instead.
+func (p *Player) SkipTo(index int) error {
+	defer p.flushEvents()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	if index < 0 || index >= len(p.Queue) {
+		return fmt.Errorf("index out of range")
 	}
 	
-	// If queue is empty, stop playback
-	p.Playing = false
-	p.Current = nil
-	return fmt.Errorf("queue is empty")
+	skipped := append([]*Track(nil), p.Queue[:index]...)
+	p.Queue = p.Queue[index:]
+	
+	err := p.skipLocked()
+	
+	// The skipped tracks come round again after the one that was playing
+	if p.loop == LoopQueue {
+		p.Queue = append(p.Queue, skipped...)
+	}
+	
+	return err
+}
+
+func (p *Player) skipLocked() error {
+	p.stopLocked()
+	
+	if p.Current != nil {
+		p.emitLocked(Event{Type: EventTrackEnded, Track: p.Current})
+	}
+	
+	// If queue is empty, playback stops
+	return p.advanceLocked(p.Current, true)
 }
 
-func (p *Player) SetVolume(volume float64) {
+// SetVolume changes the volume, restarting the stream so it applies
+// mid-track. The error is from the restart; the volume is set regardless.
+func (p *Player) SetVolume(volume float64) error {
+	defer p.flushEvents()
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
@@ -125,6 +264,87 @@ func (p *Player) SetVolume(volume float64) {
 	}
 	
 	p.volume = volume
+	
+	// ffmpeg applies the volume, so restart it from the current position
+	if p.stream != nil {
+		return p.restartLocked(p.positionLocked())
+	}
+	
+	return nil
+}
+
+// SetFilters replaces the audio effects, restarting the stream from the
+// current position so they apply mid-track.
+func (p *Player) SetFilters(filters FilterSet) error {
+	defer p.flushEvents()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	p.filters = filters
+	
+	if p.stream != nil {
+		return p.restartLocked(p.positionLocked())
+	}
+	
+	return nil
+}
+
+func (p *Player) GetFilters() FilterSet {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	return p.filters
+}
+
+// Seek restarts the current track at position.
+func (p *Player) Seek(position time.Duration) error {
+	defer p.flushEvents()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	if p.Current == nil {
+		return fmt.Errorf("nothing is playing")
+	}
+	
+	if p.Current.Live {
+		return fmt.Errorf("cannot seek in a live stream")
+	}
+	
+	if position < 0 || (p.Current.Duration > 0 && position >= p.Current.Duration) {
+		return fmt.Errorf("position out of range")
+	}
+	
+	if p.stream == nil {
+		return fmt.Errorf("not connected to voice")
+	}
+	
+	return p.restartLocked(position)
+}
+
+// Position reports how far into the current track playback is.
+func (p *Player) Position() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	return p.positionLocked()
+}
+
+// GetStreamTitle returns what a live track currently has on air, as
+// reported by the station's metadata, or "" if unknown.
+func (p *Player) GetStreamTitle() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	return p.title
+}
+
+func (p *Player) positionLocked() time.Duration {
+	if p.stream == nil {
+		return p.resumeAt
+	}
+	
+	played := time.Duration(p.stream.frames) * FrameDuration
+	return p.stream.offset + time.Duration(float64(played)*p.stream.rate)
 }
 
 func (p *Player) GetVolume() float64 {
@@ -166,62 +386,120 @@ func (p *Player) IsPlaying() bool {
 	return p.Playing
 }
 
+// IsIdle reports whether the player has nothing playing and nothing queued
+func (p *Player) IsIdle() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	return p.Current == nil && len(p.Queue) == 0
+}
+
 func (p *Player) ClearQueue() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
 	p.Queue = make([]*Track, 0)
+	p.unshuffled = nil
 }
 
-func (p *Player) RemoveFromQueue(index int) error {
+// RemoveFromQueue removes the track at index and returns it.
+func (p *Player) RemoveFromQueue(index int) (*Track, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
 	if index < 0 || index >= len(p.Queue) {
-		return fmt.Errorf("index out of range")
+		return nil, fmt.Errorf("index out of range")
 	}
 	
 	// Remove track at index
+	track := p.Queue[index]
 	p.Queue = append(p.Queue[:index], p.Queue[index+1:]...)
 	
-	return nil
+	return track, nil
 }
 
-func (p *Player) MoveInQueue(from, to int) error {
+// RemoveIf removes the track at index if allow approves of it, looking the
+// track up and removing it in one go so the queue can't change in between.
+// It returns ErrNotAllowed, and leaves the queue alone, if allow says no.
+func (p *Player) RemoveIf(index int, allow func(track *Track) bool) (*Track, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
-	if from < 0 || from >= len(p.Queue) || to < 0 || to >= len(p.Queue) {
-		return fmt.Errorf("index out of range")
+	if index < 0 || index >= len(p.Queue) {
+		return nil, fmt.Errorf("index out of range")
 	}
 	
-	if from == to {
-		return nil
+	track := p.Queue[index]
+	if !allow(track) {
+		return track, ErrNotAllowed
+	}
+	p.Queue = append(p.Queue[:index], p.Queue[index+1:]...)
+	
+	return track, nil
+}
+
+// MoveInQueue moves the track at index from so that it ends up at index to,
+// and returns the track moved.
+func (p *Player) MoveInQueue(from, to int) (*Track, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	if from < 0 || from >= len(p.Queue) || to < 0 || to >= len(p.Queue) {
+		return nil, fmt.Errorf("index out of range")
 	}
 	
 	// Move track from 'from' to 'to'
 	track := p.Queue[from]
+	if from == to {
+		return track, nil
+	}
 	
 	// Remove from original position
 	p.Queue = append(p.Queue[:from], p.Queue[from+1:]...)
 	
 	// Insert at new position
-	if to > from {
-		to-- // Adjust for removed element
-	}
-	
 	p.Queue = append(p.Queue[:to], append([]*Track{track}, p.Queue[to:]...)...)
 	
-	return nil
+	return track, nil
 }
 
-func (p *Player) ConnectToVoice(channelID string) error {
+// ConnectToVoice joins the given voice channel. If a track is waiting to
+// be played it starts streaming as soon as the connection is up.
+func (p *Player) ConnectToVoice(guildID, channelID string) error {
+	defer p.flushEvents()
+	p.mu.Lock()
+	connector := p.connector
+	joined := p.voiceConn.Connected && p.voiceConn.ChannelID == channelID && p.voiceConn.sink != nil
+	p.mu.Unlock()
+	
+	if joined {
+		return nil
+	}
+	
+	// Joining can take several seconds, so don't hold the lock for it
+	var sink VoiceSink
+	if connector != nil {
+		var err error
+		sink, err = connector.JoinVoice(guildID, channelID)
+		if err != nil {
+			return err
+		}
+	}
+	
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
-	// In a real implementation, this would connect to the voice channel
+	p.voiceConn.GuildID = guildID
 	p.voiceConn.ChannelID = channelID
 	p.voiceConn.Connected = true
+	p.voiceConn.sink = sink
+	
+	if p.Playing && p.Current != nil && p.stream == nil {
+		if err := p.startLocked(p.Current, p.resumeAt); err != nil {
+			p.emitLocked(Event{Type: EventError, Track: p.Current, Err: err})
+			return err
+		}
+	}
 	
 	return nil
 }
@@ -230,11 +508,19 @@ func (p *Player) DisconnectFromVoice() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
-	// In a real implementation, this would disconnect from the voice channel
+	p.stopLocked()
+	p.Playing = false
+	
+	var err error
+	if p.voiceConn.sink != nil {
+		err = p.voiceConn.sink.Disconnect()
+	}
+	
 	p.voiceConn.Connected = false
 	p.voiceConn.ChannelID = ""
+	p.voiceConn.sink = nil
 	
-	return nil
+	return err
 }
 
 func (p *Player) IsConnectedToVoice() bool {
@@ -242,4 +528,267 @@ func (p *Player) IsConnectedToVoice() bool {
 	defer p.mu.Unlock()
 	
 	return p.voiceConn.Connected
-}
\ No newline at end of file
+}
+
+func (p *Player) GetVoiceChannelID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	return p.voiceConn.ChannelID
+}
+
+// VoiceChannelMoved records that the bot was moved to another voice
+// channel in the same guild, e.g. dragged there by a moderator. The voice
+// connection follows by itself, so only the channel ID needs updating.
+func (p *Player) VoiceChannelMoved(channelID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	if p.voiceConn.Connected {
+		p.voiceConn.ChannelID = channelID
+	}
+}
+
+// playNextLocked makes the next queued track current and starts it.
+// Tracks that fail to open are reported and skipped.
+func (p *Player) playNextLocked() error {
+	last := p.Current
+	
+	for len(p.Queue) > 0 {
+		track := p.Queue[0]
+		p.Queue = p.Queue[1:]
+		p.Current = track
+		p.Playing = true
+		p.resumeAt = 0
+		p.skipVotes = nil
+		p.markPlayedLocked(track)
+		
+		if err := p.startLocked(track, 0); err != nil {
+			p.emitLocked(Event{Type: EventError, Track: track, Err: err})
+			last = track
+			continue
+		}
+		
+		p.emitLocked(Event{Type: EventTrackStarted, Track: track})
+		return nil
+	}
+	
+	p.Current = nil
+	p.Playing = false
+	
+	// Autoplay reports QueueEmpty itself if it finds nothing
+	if !p.autoplayLocked(last) {
+		p.emitLocked(Event{Type: EventQueueEmpty, Track: last})
+	}
+	
+	return fmt.Errorf("queue is empty")
+}
+
+// startLocked opens the track at offset and streams it to the voice sink.
+// It is a no-op while the player has no voice connection.
+func (p *Player) startLocked(track *Track, offset time.Duration) error {
+	sink := p.voiceConn.sink
+	if !p.voiceConn.Connected || sink == nil || p.source == nil {
+		return nil
+	}
+	
+	if p.needsStreamLocked(track) {
+		p.resolveLocked(track, offset)
+		return nil
+	}
+	
+	// Live streams always join at the live edge
+	start := offset
+	if track.Live {
+		start = 0
+	}
+	
+	reader, err := p.source.Open(track, p.streamOptionsLocked(start))
+	if err != nil {
+		return fmt.Errorf("failed to open audio stream: %w", err)
+	}
+	
+	pb := &playback{
+		track:  track,
+		reader: reader,
+		offset: offset,
+		rate:   p.filters.Rate(),
+	}
+	if track.Live {
+		pb.rate = 1
+	}
+	p.stream = pb
+	p.resumeAt = 0
+	p.findSegmentsLocked(track)
+	
+	go p.run(pb, sink)
+	
+	if track.Live && p.metadata != nil {
+		pb.metaStop = make(chan struct{})
+		go p.metadata.Watch(track, pb.metaStop, func(title string) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			
+			if p.stream == pb {
+				p.title = title
+			}
+		})
+	}
+	
+	return nil
+}
+
+// stopLocked ends the active stream, if any. The stream goroutine notices
+// and exits without touching player state.
+func (p *Player) stopLocked() {
+	pb := p.stream
+	if pb == nil {
+		return
+	}
+	
+	p.stream = nil
+	pb.stopped = true
+	p.cond.Broadcast()
+	pb.reader.Close()
+	pb.stopMetadata()
+	pb.dropHandoff()
+	p.title = ""
+}
+
+func (p *Player) streamOptionsLocked(start time.Duration) StreamOptions {
+	return StreamOptions{
+		Volume:    p.volume,
+		Start:     start,
+		Filters:   p.filters,
+		Normalize: p.normalize,
+	}
+}
+
+func (pb *playback) stopMetadata() {
+	if pb.metaStop != nil {
+		close(pb.metaStop)
+		pb.metaStop = nil
+	}
+}
+
+// restartLocked reopens the current stream at position, which is also
+// how ffmpeg picks up changed options. If the track can't be reopened,
+// e.g. because its stream URL expired, the error is reported and the
+// player moves on to the next track rather than sitting on a dead one.
+func (p *Player) restartLocked(position time.Duration) error {
+	pb := p.stream
+	paused := pb.paused
+	
+	p.stopLocked()
+	if err := p.startLocked(pb.track, position); err != nil {
+		p.emitLocked(Event{Type: EventError, Track: pb.track, Err: err})
+		p.emitLocked(Event{Type: EventTrackEnded, Track: pb.track})
+		p.advanceLocked(pb.track, true)
+		return err
+	}
+	
+	if p.stream != nil {
+		p.stream.paused = paused
+	}
+	
+	return nil
+}
+
+// run pumps frames from pb into sink until the track ends or is stopped,
+// then moves on to the next queued track.
+func (p *Player) run(pb *playback, sink VoiceSink) {
+	defer p.flushEvents()
+	sink.Speaking(true)
+	defer sink.Speaking(false)
+	
+	var err error
+	for {
+		p.mu.Lock()
+		for pb.paused && !pb.stopped {
+			p.cond.Wait()
+		}
+		stopped := pb.stopped
+		p.mu.Unlock()
+		
+		if stopped {
+			return
+		}
+		
+		var frame []byte
+		frame, err = pb.reader.ReadFrame()
+		if err != nil {
+			break
+		}
+		
+		p.mu.Lock()
+		stopped = pb.stopped
+		p.mu.Unlock()
+		
+		if stopped {
+			return
+		}
+		
+		if err = sink.SendOpus(frame); err != nil {
+			break
+		}
+		
+		p.mu.Lock()
+		pb.frames++
+		handedOff := p.transitionLocked(pb, sink) || p.skipSegmentLocked(pb)
+		p.mu.Unlock()
+		
+		if handedOff {
+			return
+		}
+		
+		// Switching tracks mid-stream emits events
+		p.flushEvents()
+	}
+	
+	pb.reader.Close()
+	
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	// The track finished on its own; anything else already replaced the stream
+	if p.stream != pb {
+		return
+	}
+	
+	p.stream = nil
+	pb.stopMetadata()
+	pb.dropHandoff()
+	
+	if err != io.EOF {
+		p.emitLocked(Event{Type: EventError, Track: pb.track, Err: err})
+	}
+	p.emitLocked(Event{Type: EventTrackEnded, Track: pb.track})
+	
+	// A track that failed is not worth repeating
+	p.advanceLocked(pb.track, err != io.EOF)
+}
+
+func (p *Player) emitLocked(event Event) {
+	if len(p.handlers) == 0 {
+		return
+	}
+	
+	p.pending = append(p.pending, event)
+}
+
+// flushEvents delivers queued events once the lock has been released.
+// Methods that emit events defer it before taking the lock.
+func (p *Player) flushEvents() {
+	p.mu.Lock()
+	events := p.pending
+	p.pending = nil
+	handlers := make([]EventHandler, len(p.handlers))
+	copy(handlers, p.handlers)
+	p.mu.Unlock()
+	
+	for _, event := range events {
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
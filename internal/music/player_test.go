@@ -1,6 +1,12 @@
 package music
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -112,4 +118,634 @@ func TestQueueOperations(t *testing.T) {
 	if queue[1].Title != "Song 2" {
 		t.Errorf("Expected second track title to be 'Song 2', got '%s'", queue[1].Title)
 	}
-}
\ No newline at end of file
+
+	// AddNext jumps the queue
+	player.AddNext(&Track{Title: "Song 3", URL: "url3"})
+
+	queue = player.GetQueue()
+	if len(queue) != 3 || queue[0].Title != "Song 3" {
+		t.Errorf("Expected 'Song 3' to be first in the queue, got %v", queue)
+	}
+}
+
+func TestQueueMoveAndRemove(t *testing.T) {
+	player := NewPlayer()
+	for _, title := range []string{"a", "b", "c", "d"} {
+		player.AddToQueue(&Track{Title: title})
+	}
+
+	titles := func() string {
+		var result string
+		for _, track := range player.GetQueue() {
+			result += track.Title
+		}
+		return result
+	}
+
+	// Moving down puts the track at the requested position
+	moved, err := player.MoveInQueue(0, 3)
+	if err != nil {
+		t.Fatalf("Failed to move track: %v", err)
+	}
+	if moved.Title != "a" {
+		t.Errorf("Expected to move 'a', got '%s'", moved.Title)
+	}
+	if got := titles(); got != "bcda" {
+		t.Errorf("Expected 'bcda' after moving first to last, got '%s'", got)
+	}
+
+	player.MoveInQueue(3, 1)
+	if got := titles(); got != "bacd" {
+		t.Errorf("Expected 'bacd' after moving last to second, got '%s'", got)
+	}
+
+	if _, err := player.MoveInQueue(0, 4); err == nil {
+		t.Error("Expected error moving out of range")
+	}
+
+	removed, err := player.RemoveFromQueue(2)
+	if err != nil || removed.Title != "c" {
+		t.Errorf("Expected to remove 'c', got %v (%v)", removed, err)
+	}
+	if got := titles(); got != "bad" {
+		t.Errorf("Expected 'bad' after removing, got '%s'", got)
+	}
+
+	if _, err := player.RemoveFromQueue(3); err == nil {
+		t.Error("Expected error removing out of range")
+	}
+
+	// RemoveIf checks the track it is about to remove, not a stale copy
+	if _, err := player.RemoveIf(0, func(track *Track) bool { return track.Title != "b" }); err != ErrNotAllowed {
+		t.Errorf("Expected ErrNotAllowed, got %v", err)
+	}
+	removed, err = player.RemoveIf(1, func(track *Track) bool { return track.Title == "a" })
+	if err != nil || removed.Title != "a" {
+		t.Errorf("Expected to remove 'a', got %v (%v)", removed, err)
+	}
+	if _, err := player.RemoveIf(5, func(*Track) bool { return true }); err == nil {
+		t.Error("Expected error removing out of range")
+	}
+	if got := titles(); got != "bd" {
+		t.Errorf("Expected 'bd' after removing, got '%s'", got)
+	}
+}
+
+func TestPlayerSkipTo(t *testing.T) {
+	player := NewPlayer()
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		player.AddToQueue(&Track{Title: title, URL: title})
+	}
+	player.Play()
+
+	if err := player.SkipTo(2); err != nil {
+		t.Fatalf("Failed to skip: %v", err)
+	}
+
+	if current := player.GetCurrentTrack(); current == nil || current.Title != "d" {
+		t.Fatalf("Expected 'd' to be playing, got %v", current)
+	}
+	if queue := player.GetQueue(); len(queue) != 1 || queue[0].Title != "e" {
+		t.Errorf("Expected only 'e' left in the queue, got %v", queue)
+	}
+
+	if err := player.SkipTo(1); err == nil {
+		t.Error("Expected error skipping out of range")
+	}
+
+	// Looping the queue keeps the skipped tracks
+	player.AddToQueue(&Track{Title: "f", URL: "f"})
+	player.AddToQueue(&Track{Title: "g", URL: "g"})
+	player.SetLoopMode(LoopQueue)
+	player.SkipTo(1)
+
+	var titles string
+	for _, track := range player.GetQueue() {
+		titles += track.Title
+	}
+	if current := player.GetCurrentTrack(); current.Title != "f" || titles != "gde" {
+		t.Errorf("Expected 'f' playing with 'gde' queued, got '%s' with '%s'", current.Title, titles)
+	}
+}
+
+type fakeSink struct {
+	frames chan []byte
+}
+
+func newFakeSink() *fakeSink {
+	return &fakeSink{frames: make(chan []byte)}
+}
+
+func (s *fakeSink) SendOpus(frame []byte) error {
+	select {
+	case s.frames <- frame:
+		return nil
+	case <-time.After(time.Second):
+		return fmt.Errorf("nobody is listening")
+	}
+}
+
+func (s *fakeSink) Speaking(speaking bool) error { return nil }
+
+func (s *fakeSink) Disconnect() error { return nil }
+
+type fakeConnector struct {
+	sink *fakeSink
+}
+
+func (c *fakeConnector) JoinVoice(guildID, channelID string) (VoiceSink, error) {
+	return c.sink, nil
+}
+
+// fakeSource hands out readers that produce a fixed number of frames
+type fakeSource struct {
+	mu       sync.Mutex
+	frames   int
+	opened   []StreamOptions
+	failOpen int // Which open fails, counting from 1; 0 for none
+}
+
+func (f *fakeSource) Open(track *Track, opts StreamOptions) (FrameReader, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.opened = append(f.opened, opts)
+	if len(f.opened) == f.failOpen {
+		return nil, fmt.Errorf("stream URL expired")
+	}
+	return &fakeReader{remaining: f.frames, track: track}, nil
+}
+
+func (f *fakeSource) openCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.opened)
+}
+
+type fakeReader struct {
+	mu        sync.Mutex
+	remaining int
+	track     *Track
+}
+
+func (r *fakeReader) ReadFrame() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.remaining <= 0 {
+		return nil, io.EOF
+	}
+	r.remaining--
+	return []byte(r.track.URL), nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func newTestPlayer(frames int) (*Player, *fakeSink, *fakeSource) {
+	sink := newFakeSink()
+	source := &fakeSource{frames: frames}
+	return NewVoicePlayer(&fakeConnector{sink: sink}, source), sink, source
+}
+
+func receiveFrame(t *testing.T, sink *fakeSink) []byte {
+	t.Helper()
+
+	select {
+	case frame := <-sink.frames:
+		return frame
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for audio frame")
+		return nil
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for player state")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPlayerStreamsToVoice(t *testing.T) {
+	player, sink, _ := newTestPlayer(3)
+
+	if err := player.ConnectToVoice("guild", "channel"); err != nil {
+		t.Fatalf("Failed to connect to voice: %v", err)
+	}
+
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	if err := player.Play(); err != nil {
+		t.Fatalf("Failed to play: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if frame := receiveFrame(t, sink); string(frame) != "url1" {
+			t.Errorf("Expected frame from 'url1', got '%s'", frame)
+		}
+	}
+
+	// The track ends once the source runs out of frames
+	waitFor(t, func() bool { return player.GetCurrentTrack() == nil })
+
+	if player.IsPlaying() {
+		t.Error("Expected Playing to be false after track ended, got true")
+	}
+}
+
+func TestPlayerStartsOnConnect(t *testing.T) {
+	player, sink, source := newTestPlayer(1)
+
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	if err := player.Play(); err != nil {
+		t.Fatalf("Failed to play: %v", err)
+	}
+
+	if source.openCount() != 0 {
+		t.Errorf("Expected no stream before connecting, got %d", source.openCount())
+	}
+
+	if err := player.ConnectToVoice("guild", "channel"); err != nil {
+		t.Fatalf("Failed to connect to voice: %v", err)
+	}
+
+	receiveFrame(t, sink)
+}
+
+func TestPlayerVoiceChannelMoved(t *testing.T) {
+	player, _, _ := newTestPlayer(1)
+
+	// Not connected, so there is no channel to move
+	player.VoiceChannelMoved("other")
+	if channel := player.GetVoiceChannelID(); channel != "" {
+		t.Errorf("Expected no channel before connecting, got %q", channel)
+	}
+
+	player.ConnectToVoice("guild", "channel")
+	player.VoiceChannelMoved("other")
+
+	if channel := player.GetVoiceChannelID(); channel != "other" {
+		t.Errorf("Expected channel to be 'other' after the move, got %q", channel)
+	}
+	if !player.IsConnectedToVoice() {
+		t.Error("Expected player to stay connected after the move")
+	}
+}
+
+func TestPlayerPauseResume(t *testing.T) {
+	player, sink, _ := newTestPlayer(1000)
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.Play()
+
+	receiveFrame(t, sink)
+	player.Pause()
+
+	// At most one frame that was already read may still be delivered
+	drained := 0
+	for done := false; !done; {
+		select {
+		case <-sink.frames:
+			drained++
+		case <-time.After(50 * time.Millisecond):
+			done = true
+		}
+	}
+	if drained > 1 {
+		t.Errorf("Expected playback to stop while paused, got %d frames", drained)
+	}
+
+	player.Resume()
+	receiveFrame(t, sink)
+
+	if !player.IsPlaying() {
+		t.Error("Expected Playing to be true after resume, got false")
+	}
+
+	player.Stop()
+}
+
+func TestPlayerSkipAndStop(t *testing.T) {
+	player, sink, _ := newTestPlayer(1000)
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.AddToQueue(&Track{Title: "Song 2", URL: "url2"})
+	player.Play()
+
+	receiveFrame(t, sink)
+
+	if err := player.Skip(); err != nil {
+		t.Fatalf("Failed to skip: %v", err)
+	}
+
+	// Frames of the first track may still be in flight
+	waitFor(t, func() bool { return string(receiveFrame(t, sink)) == "url2" })
+
+	if player.GetCurrentTrack().Title != "Song 2" {
+		t.Errorf("Expected current track to be 'Song 2', got '%s'", player.GetCurrentTrack().Title)
+	}
+
+	player.Stop()
+
+	if player.GetCurrentTrack() != nil {
+		t.Error("Expected no current track after stop")
+	}
+
+	if err := player.Skip(); err == nil {
+		t.Error("Expected error skipping with empty queue, got nil")
+	}
+}
+
+func TestPlayerSetVolumeRestartsStream(t *testing.T) {
+	player, sink, source := newTestPlayer(1000)
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.Play()
+
+	for i := 0; i < 5; i++ {
+		receiveFrame(t, sink)
+	}
+
+	player.SetVolume(0.5)
+
+	if source.openCount() != 2 {
+		t.Fatalf("Expected stream to be reopened, got %d opens", source.openCount())
+	}
+
+	source.mu.Lock()
+	opts := source.opened[1]
+	source.mu.Unlock()
+
+	if opts.Volume != 0.5 {
+		t.Errorf("Expected reopened stream volume to be 0.5, got %f", opts.Volume)
+	}
+
+	if opts.Start < 4*FrameDuration {
+		t.Errorf("Expected reopened stream to resume past %v, got %v", 4*FrameDuration, opts.Start)
+	}
+
+	player.Stop()
+}
+
+func TestPlayerStreamsLocalFile(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+
+	path := filepath.Join(t.TempDir(), "tone.wav")
+	if err := os.WriteFile(path, silentWAV(time.Second), 0644); err != nil {
+		t.Fatalf("Failed to write test audio file: %v", err)
+	}
+
+	sink := newFakeSink()
+	player := NewVoicePlayer(&fakeConnector{sink: sink}, NewFFmpegSource())
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Tone", URL: path})
+	if err := player.Play(); err != nil {
+		t.Fatalf("Failed to play: %v", err)
+	}
+
+	frames := 0
+	for player.GetCurrentTrack() != nil {
+		select {
+		case <-sink.frames:
+			frames++
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if frames < 45 {
+		t.Errorf("Expected about 50 frames for one second of audio, got %d", frames)
+	}
+}
+
+func TestPlayerAdvancesQueueAndEmitsEvents(t *testing.T) {
+	player, sink, _ := newTestPlayer(2)
+
+	events := make(chan Event, 16)
+	player.Subscribe(func(e Event) { events <- e })
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.AddToQueue(&Track{Title: "Song 2", URL: "url2"})
+	player.Play()
+
+	// Both tracks play back to back without another Play or Skip
+	expectedFrames := []string{"url1", "url1", "url2", "url2"}
+	for _, want := range expectedFrames {
+		if frame := receiveFrame(t, sink); string(frame) != want {
+			t.Errorf("Expected frame from '%s', got '%s'", want, frame)
+		}
+	}
+
+	expected := []struct {
+		Type  EventType
+		Title string
+	}{
+		{EventTrackStarted, "Song 1"},
+		{EventTrackEnded, "Song 1"},
+		{EventTrackStarted, "Song 2"},
+		{EventTrackEnded, "Song 2"},
+		{EventQueueEmpty, "Song 2"},
+	}
+
+	for _, want := range expected {
+		select {
+		case e := <-events:
+			if e.Type != want.Type || e.Track == nil || e.Track.Title != want.Title {
+				t.Errorf("Expected %v for '%s', got %v for %+v", want.Type, want.Title, e.Type, e.Track)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %v event", want.Type)
+		}
+	}
+
+	if player.GetCurrentTrack() != nil {
+		t.Error("Expected no current track after queue ran out")
+	}
+}
+
+func TestPlayerSkipEmitsEvents(t *testing.T) {
+	player := NewPlayer()
+
+	var events []Event
+	player.Subscribe(func(e Event) { events = append(events, e) })
+
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.Play()
+
+	if err := player.Skip(); err == nil {
+		t.Error("Expected error skipping past the last track, got nil")
+	}
+
+	expected := []EventType{EventTrackStarted, EventTrackEnded, EventQueueEmpty}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(events))
+	}
+
+	for i, want := range expected {
+		if events[i].Type != want {
+			t.Errorf("Event %d: expected %v, got %v", i, want, events[i].Type)
+		}
+	}
+}
+
+func TestPlayerSeekAndPosition(t *testing.T) {
+	player, sink, source := newTestPlayer(1000)
+
+	if err := player.Seek(time.Second); err == nil {
+		t.Error("Expected error seeking with nothing playing, got nil")
+	}
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1", Duration: 3 * time.Minute})
+	player.Play()
+
+	for i := 0; i < 3; i++ {
+		receiveFrame(t, sink)
+	}
+
+	if player.Position() < 2*FrameDuration {
+		t.Errorf("Expected position to advance with frames sent, got %v", player.Position())
+	}
+
+	if err := player.Seek(5 * time.Minute); err == nil {
+		t.Error("Expected error seeking past the end of the track, got nil")
+	}
+
+	if err := player.Seek(time.Minute); err != nil {
+		t.Fatalf("Failed to seek: %v", err)
+	}
+
+	source.mu.Lock()
+	start := source.opened[len(source.opened)-1].Start
+	source.mu.Unlock()
+
+	if start != time.Minute {
+		t.Errorf("Expected stream to restart at 1m0s, got %v", start)
+	}
+
+	if player.Position() < time.Minute {
+		t.Errorf("Expected position to be at least 1m0s after seek, got %v", player.Position())
+	}
+
+	player.Stop()
+}
+
+func TestPlayerRestartFailureMovesOn(t *testing.T) {
+	player, sink, source := newTestPlayer(1000)
+	source.failOpen = 2
+
+	events := make(chan Event, 10)
+	player.Subscribe(func(event Event) { events <- event })
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1", Duration: 3 * time.Minute})
+	player.AddToQueue(&Track{Title: "Song 2", URL: "url2", Duration: 3 * time.Minute})
+	player.Play()
+	receiveFrame(t, sink)
+
+	// The reopen fails, so instead of sitting on a dead stream the player
+	// reports it and plays the next track
+	if err := player.Seek(time.Minute); err == nil {
+		t.Error("Expected the failed reopen to be reported, got nil")
+	}
+
+	current := player.GetCurrentTrack()
+	if current == nil || current.Title != "Song 2" || !player.IsPlaying() {
+		t.Fatalf("Expected Song 2 to be playing, got %v", current)
+	}
+	waitFor(t, func() bool { return string(receiveFrame(t, sink)) == "url2" })
+
+	var types []EventType
+	waitFor(t, func() bool {
+		select {
+		case event := <-events:
+			types = append(types, event.Type)
+		default:
+		}
+		return len(types) == 4
+	})
+	if types[1] != EventError || types[2] != EventTrackEnded || types[3] != EventTrackStarted {
+		t.Errorf("Expected TrackStarted, Error, TrackEnded, TrackStarted, got %v", types)
+	}
+
+	// Settings that restart the stream report failures the same way
+	source.mu.Lock()
+	source.failOpen = len(source.opened) + 1
+	source.mu.Unlock()
+	if err := player.SetVolume(0.5); err == nil {
+		t.Error("Expected the failed restart to be reported, got nil")
+	}
+	if player.IsPlaying() || player.GetCurrentTrack() != nil {
+		t.Error("Expected the player to stop with nothing left to play")
+	}
+}
+
+// fakeMetadata reports a scripted sequence of titles, then waits to be stopped
+type fakeMetadata struct {
+	titles  []string
+	stopped chan struct{}
+}
+
+func (f *fakeMetadata) Watch(track *Track, stop <-chan struct{}, onTitle func(title string)) {
+	for _, title := range f.titles {
+		onTitle(title)
+	}
+	<-stop
+	f.stopped <- struct{}{}
+}
+
+func TestPlayerLiveTrack(t *testing.T) {
+	player, sink, source := newTestPlayer(1000)
+	metadata := &fakeMetadata{titles: []string{"Artist - Song"}, stopped: make(chan struct{}, 2)}
+	player.metadata = metadata
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Radio", URL: "radio", Live: true})
+	player.Play()
+
+	receiveFrame(t, sink)
+
+	waitFor(t, func() bool { return player.GetStreamTitle() == "Artist - Song" })
+
+	if err := player.Seek(time.Second); err == nil {
+		t.Error("Expected error seeking in a live stream, got nil")
+	}
+
+	// Restarting a live stream should rejoin at the live edge
+	player.SetVolume(0.5)
+	receiveFrame(t, sink)
+
+	source.mu.Lock()
+	start := source.opened[len(source.opened)-1].Start
+	source.mu.Unlock()
+
+	if start != 0 {
+		t.Errorf("Expected live stream to restart from the live edge, got %v", start)
+	}
+
+	player.Stop()
+
+	// One watcher per stream: the original and the restarted one
+	for i := 0; i < 2; i++ {
+		select {
+		case <-metadata.stopped:
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for metadata watcher to stop")
+		}
+	}
+
+	if player.GetStreamTitle() != "" {
+		t.Errorf("Expected stream title to be cleared after stop, got %q", player.GetStreamTitle())
+	}
+}
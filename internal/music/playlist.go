@@ -0,0 +1,349 @@
+package music
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPlaylistTracks is the most tracks a saved playlist can hold.
+const MaxPlaylistTracks = 500
+
+// ErrPlaylistNotFound is returned for playlists that were never saved.
+var ErrPlaylistNotFound = errors.New("playlist not found")
+
+var playlistName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// PlaylistScope says who a saved playlist belongs to.
+type PlaylistScope string
+
+const (
+	ScopeUser   PlaylistScope = "user"   // Owned by one user, available in every server
+	ScopeServer PlaylistScope = "server" // Shared with everyone in one server
+)
+
+// Playlist is a named list of tracks saved by a user or for a server.
+type Playlist struct {
+	Name    string        `json:"name"`
+	Scope   PlaylistScope `json:"scope"`
+	Owner   string        `json:"owner"`   // User ID, or guild ID for server playlists
+	Creator string        `json:"creator"` // User ID of whoever saved it first
+	Tracks  []*Track      `json:"tracks"`
+	Updated time.Time     `json:"updated"`
+}
+
+// NormalizePlaylistName lowercases name and checks that it is safe to use
+// as a file name: up to 32 letters, digits, dashes and underscores.
+func NormalizePlaylistName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !playlistName.MatchString(name) {
+		return "", fmt.Errorf("invalid playlist name %q: use up to 32 letters, digits, - and _", name)
+	}
+	return name, nil
+}
+
+// Add appends tracks, keeping only what is worth saving about each one.
+func (pl *Playlist) Add(tracks ...*Track) error {
+	if len(pl.Tracks)+len(tracks) > MaxPlaylistTracks {
+		return fmt.Errorf("playlists can hold at most %d tracks", MaxPlaylistTracks)
+	}
+
+	for _, track := range tracks {
+		pl.Tracks = append(pl.Tracks, savedTrack(track))
+	}
+	return nil
+}
+
+// Remove deletes the track at index (0-based) and returns it.
+func (pl *Playlist) Remove(index int) (*Track, error) {
+	if index < 0 || index >= len(pl.Tracks) {
+		return nil, fmt.Errorf("index out of range")
+	}
+
+	track := pl.Tracks[index]
+	pl.Tracks = append(pl.Tracks[:index], pl.Tracks[index+1:]...)
+	return track, nil
+}
+
+// Duration is the total length of the playlist's tracks.
+func (pl *Playlist) Duration() time.Duration {
+	var total time.Duration
+	for _, track := range pl.Tracks {
+		total += track.Duration
+	}
+	return total
+}
+
+// savedTrack copies the parts of track that stay valid, leaving out who
+// queued it and where
+func savedTrack(track *Track) *Track {
+	return &Track{
+		ID:        track.ID,
+		Title:     track.Title,
+		URL:       track.URL,
+		Duration:  track.Duration,
+		Thumbnail: track.Thumbnail,
+		Uploader:  track.Uploader,
+		Live:      track.Live,
+	}
+}
+
+// PlaylistStore keeps saved playlists as JSON files, one directory per
+// scope and owner.
+type PlaylistStore struct {
+	Dir string
+}
+
+func NewPlaylistStore(dir string) *PlaylistStore {
+	return &PlaylistStore{Dir: dir}
+}
+
+func (s *PlaylistStore) dir(scope PlaylistScope, owner string) string {
+	return filepath.Join(s.Dir, string(scope), owner)
+}
+
+func (s *PlaylistStore) path(scope PlaylistScope, owner, name string) string {
+	return filepath.Join(s.dir(scope, owner), name+".json")
+}
+
+func (s *PlaylistStore) Get(scope PlaylistScope, owner, name string) (*Playlist, error) {
+	name, err := NormalizePlaylistName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(s.path(scope, owner, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrPlaylistNotFound
+		}
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+
+	var pl Playlist
+	if err := json.Unmarshal(data, &pl); err != nil {
+		return nil, fmt.Errorf("failed to decode playlist: %w", err)
+	}
+
+	return &pl, nil
+}
+
+// Save writes pl, replacing any playlist with the same name, scope and
+// owner.
+func (s *PlaylistStore) Save(pl *Playlist) error {
+	name, err := NormalizePlaylistName(pl.Name)
+	if err != nil {
+		return err
+	}
+	if pl.Owner == "" || strings.ContainsAny(pl.Owner, `/\.`) {
+		return fmt.Errorf("invalid playlist owner %q", pl.Owner)
+	}
+	pl.Name = name
+
+	dir := s.dir(pl.Scope, pl.Owner)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create playlist directory: %w", err)
+	}
+
+	data, err := json.Marshal(pl)
+	if err != nil {
+		return fmt.Errorf("failed to encode playlist: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file
+	tmp := s.path(pl.Scope, pl.Owner, name) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write playlist: %w", err)
+	}
+
+	return os.Rename(tmp, s.path(pl.Scope, pl.Owner, name))
+}
+
+func (s *PlaylistStore) Delete(scope PlaylistScope, owner, name string) error {
+	name, err := NormalizePlaylistName(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(s.path(scope, owner, name))
+	if os.IsNotExist(err) {
+		return ErrPlaylistNotFound
+	}
+	return err
+}
+
+// List returns the owner's playlists sorted by name. Unreadable files are
+// skipped.
+func (s *PlaylistStore) List(scope PlaylistScope, owner string) ([]*Playlist, error) {
+	entries, err := os.ReadDir(s.dir(scope, owner))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read playlist directory: %w", err)
+	}
+
+	var playlists []*Playlist
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		pl, err := s.Get(scope, owner, strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		playlists = append(playlists, pl)
+	}
+
+	sort.Slice(playlists, func(i, j int) bool {
+		return playlists[i].Name < playlists[j].Name
+	})
+
+	return playlists, nil
+}
+
+// ExportJSON encodes the playlist's name and tracks for sharing.
+func (pl *Playlist) ExportJSON() ([]byte, error) {
+	export := struct {
+		Name   string   `json:"name"`
+		Tracks []*Track `json:"tracks"`
+	}{pl.Name, pl.Tracks}
+
+	return json.MarshalIndent(export, "", "  ")
+}
+
+// ExportM3U encodes the playlist as an extended M3U file.
+func (pl *Playlist) ExportM3U() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&buf, "#PLAYLIST:%s\n", pl.Name)
+
+	for _, track := range pl.Tracks {
+		seconds := int(track.Duration.Seconds())
+		if track.Live || seconds == 0 {
+			seconds = -1
+		}
+		fmt.Fprintf(&buf, "#EXTINF:%d,%s\n%s\n", seconds, strings.ReplaceAll(track.Title, "\n", " "), track.URL)
+	}
+
+	return buf.Bytes()
+}
+
+// ParsePlaylist reads a playlist exported as JSON or M3U, telling them
+// apart by file extension or content. Only http(s) URLs that allow accepts
+// are kept, so an imported file can't make the player open local files or
+// internal addresses. Tracks are never imported as live, since live
+// tracks are streamed without going through yt-dlp first.
+func ParsePlaylist(filename string, data []byte, allow func(url string) bool) (*Playlist, error) {
+	var pl *Playlist
+	var err error
+
+	switch ext := strings.ToLower(path.Ext(filename)); {
+	case ext == ".json":
+		pl, err = parsePlaylistJSON(data)
+	case ext == ".m3u" || ext == ".m3u8":
+		pl, err = parseM3U(data)
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")):
+		pl, err = parsePlaylistJSON(data)
+	default:
+		pl, err = parseM3U(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if pl.Name == "" {
+		pl.Name = strings.TrimSuffix(path.Base(filename), path.Ext(filename))
+	}
+
+	var tracks []*Track
+	for _, track := range pl.Tracks {
+		if track == nil || !isHTTPURL(track.URL) || !allow(track.URL) {
+			continue
+		}
+		if track.Title == "" {
+			track.Title = track.URL
+		}
+		track = savedTrack(track)
+		track.Live = false
+		tracks = append(tracks, track)
+	}
+
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("playlist has no usable http(s) tracks")
+	}
+	if len(tracks) > MaxPlaylistTracks {
+		return nil, fmt.Errorf("playlists can hold at most %d tracks", MaxPlaylistTracks)
+	}
+
+	pl.Tracks = tracks
+	return pl, nil
+}
+
+func parsePlaylistJSON(data []byte) (*Playlist, error) {
+	var pl Playlist
+	if err := json.Unmarshal(data, &pl); err != nil {
+		return nil, fmt.Errorf("invalid playlist file: %w", err)
+	}
+	return &Playlist{Name: pl.Name, Tracks: pl.Tracks}, nil
+}
+
+func parseM3U(data []byte) (*Playlist, error) {
+	pl := &Playlist{}
+
+	var title string
+	var duration time.Duration
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			pl.Name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info := strings.TrimPrefix(line, "#EXTINF:")
+			seconds, name, _ := strings.Cut(info, ",")
+			// Attributes like tvg-id may follow the duration
+			if fields := strings.Fields(seconds); len(fields) > 0 {
+				seconds = fields[0]
+			}
+			// -1 means the length is unknown
+			n, _ := strconv.Atoi(seconds)
+			duration = 0
+			if n > 0 {
+				duration = time.Duration(n) * time.Second
+			}
+			title = strings.TrimSpace(name)
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			pl.Tracks = append(pl.Tracks, &Track{Title: title, URL: line, Duration: duration})
+			title, duration = "", 0
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid playlist file: %w", err)
+	}
+
+	return pl, nil
+}
+
+func isHTTPURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
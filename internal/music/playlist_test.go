@@ -0,0 +1,206 @@
+package music
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"discord-bot/internal/security"
+)
+
+// allowAll accepts every URL, for tests that don't check addresses
+func allowAll(url string) bool {
+	return true
+}
+
+func TestNormalizePlaylistName(t *testing.T) {
+	name, err := NormalizePlaylistName("  Chill-Mix_2 ")
+	if err != nil || name != "chill-mix_2" {
+		t.Errorf("Expected 'chill-mix_2', got %q (%v)", name, err)
+	}
+
+	for _, invalid := range []string{"", "../secret", "two words", "-leading", strings.Repeat("a", 33)} {
+		if _, err := NormalizePlaylistName(invalid); err == nil {
+			t.Errorf("Expected error for playlist name %q", invalid)
+		}
+	}
+}
+
+func TestPlaylistStore(t *testing.T) {
+	store := NewPlaylistStore(t.TempDir())
+
+	pl := &Playlist{Name: "Chill", Scope: ScopeUser, Owner: "user1", Creator: "user1"}
+	pl.Add(&Track{ID: "1", Title: "Song 1", URL: "url1", Requester: "user2", ChannelID: "channel", StreamURL: "stream"})
+
+	if err := store.Save(pl); err != nil {
+		t.Fatalf("Failed to save playlist: %v", err)
+	}
+
+	loaded, err := store.Get(ScopeUser, "user1", "CHILL")
+	if err != nil {
+		t.Fatalf("Failed to load playlist: %v", err)
+	}
+	if loaded.Name != "chill" || len(loaded.Tracks) != 1 || loaded.Tracks[0].Title != "Song 1" {
+		t.Errorf("Unexpected playlist loaded: %+v", loaded)
+	}
+	if track := loaded.Tracks[0]; track.Requester != "" || track.ChannelID != "" || track.StreamURL != "" {
+		t.Errorf("Expected requester, channel and stream URL not to be saved, got %+v", track)
+	}
+
+	// Scopes and owners don't see each other's playlists
+	if _, err := store.Get(ScopeServer, "user1", "chill"); err != ErrPlaylistNotFound {
+		t.Errorf("Expected ErrPlaylistNotFound for another scope, got %v", err)
+	}
+	if _, err := store.Get(ScopeUser, "user2", "chill"); err != ErrPlaylistNotFound {
+		t.Errorf("Expected ErrPlaylistNotFound for another owner, got %v", err)
+	}
+
+	store.Save(&Playlist{Name: "ambient", Scope: ScopeUser, Owner: "user1"})
+
+	playlists, err := store.List(ScopeUser, "user1")
+	if err != nil {
+		t.Fatalf("Failed to list playlists: %v", err)
+	}
+	if len(playlists) != 2 || playlists[0].Name != "ambient" || playlists[1].Name != "chill" {
+		t.Errorf("Expected playlists sorted by name, got %d", len(playlists))
+	}
+
+	if err := store.Delete(ScopeUser, "user1", "chill"); err != nil {
+		t.Errorf("Failed to delete playlist: %v", err)
+	}
+	if err := store.Delete(ScopeUser, "user1", "chill"); err != ErrPlaylistNotFound {
+		t.Errorf("Expected ErrPlaylistNotFound deleting twice, got %v", err)
+	}
+
+	// Owners can't escape the store directory
+	if err := store.Save(&Playlist{Name: "x", Scope: ScopeUser, Owner: "../user1"}); err == nil {
+		t.Error("Expected error for an owner with a path in it")
+	}
+
+	if playlists, err := store.List(ScopeServer, "guild1"); err != nil || len(playlists) != 0 {
+		t.Errorf("Expected no playlists for an unknown owner, got %d (%v)", len(playlists), err)
+	}
+}
+
+func TestPlaylistAddAndRemove(t *testing.T) {
+	pl := &Playlist{Name: "test"}
+	pl.Add(
+		&Track{Title: "Song 1", URL: "url1", Duration: time.Minute},
+		&Track{Title: "Song 2", URL: "url2", Duration: 2 * time.Minute},
+	)
+
+	if pl.Duration() != 3*time.Minute {
+		t.Errorf("Expected total duration of 3m, got %v", pl.Duration())
+	}
+
+	removed, err := pl.Remove(0)
+	if err != nil || removed.Title != "Song 1" {
+		t.Errorf("Expected to remove 'Song 1', got %v (%v)", removed, err)
+	}
+	if len(pl.Tracks) != 1 || pl.Tracks[0].Title != "Song 2" {
+		t.Errorf("Unexpected tracks after remove: %v", pl.Tracks)
+	}
+
+	if _, err := pl.Remove(5); err == nil {
+		t.Error("Expected error removing out of range")
+	}
+
+	full := &Playlist{Tracks: make([]*Track, MaxPlaylistTracks)}
+	if err := full.Add(&Track{URL: "url"}); err == nil {
+		t.Error("Expected error adding to a full playlist")
+	}
+}
+
+func TestPlaylistExportImport(t *testing.T) {
+	pl := &Playlist{Name: "mix"}
+	pl.Add(
+		&Track{ID: "a", Title: "Song A", URL: "https://example.com/a", Duration: 90 * time.Second},
+		&Track{Title: "Radio", URL: "https://radio.example.com/stream", Live: true},
+	)
+
+	m3u := string(pl.ExportM3U())
+	want := "#EXTM3U\n#PLAYLIST:mix\n#EXTINF:90,Song A\nhttps://example.com/a\n#EXTINF:-1,Radio\nhttps://radio.example.com/stream\n"
+	if m3u != want {
+		t.Errorf("Expected M3U:\n%s\ngot:\n%s", want, m3u)
+	}
+
+	imported, err := ParsePlaylist("export.m3u", []byte(m3u), allowAll)
+	if err != nil {
+		t.Fatalf("Failed to parse M3U: %v", err)
+	}
+	if imported.Name != "mix" || len(imported.Tracks) != 2 {
+		t.Fatalf("Unexpected playlist from M3U: %+v", imported)
+	}
+	if imported.Tracks[0].Title != "Song A" || imported.Tracks[0].Duration != 90*time.Second {
+		t.Errorf("Unexpected first track from M3U: %+v", imported.Tracks[0])
+	}
+	if imported.Tracks[1].Duration != 0 {
+		t.Errorf("Expected unknown duration for -1, got %v", imported.Tracks[1].Duration)
+	}
+
+	data, err := pl.ExportJSON()
+	if err != nil {
+		t.Fatalf("Failed to export JSON: %v", err)
+	}
+
+	// Detected from the content when the extension doesn't say
+	imported, err = ParsePlaylist("download", data, allowAll)
+	if err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if imported.Name != "mix" || len(imported.Tracks) != 2 || imported.Tracks[0].ID != "a" {
+		t.Errorf("Unexpected playlist from JSON: %+v", imported)
+	}
+	if imported.Tracks[1].Live {
+		t.Error("Expected imported tracks never to be live")
+	}
+}
+
+func TestParsePlaylistSkipsLocalFiles(t *testing.T) {
+	m3u := "#EXTM3U\n/etc/passwd\nfile:///etc/passwd\n#EXTINF:10,Good\nhttps://example.com/good\n"
+
+	pl, err := ParsePlaylist("songs.m3u8", []byte(m3u), allowAll)
+	if err != nil {
+		t.Fatalf("Failed to parse M3U: %v", err)
+	}
+
+	if pl.Name != "songs" {
+		t.Errorf("Expected name from the file name, got %q", pl.Name)
+	}
+	if len(pl.Tracks) != 1 || pl.Tracks[0].URL != "https://example.com/good" {
+		t.Errorf("Expected only the http(s) track to be kept, got %v", pl.Tracks)
+	}
+
+	if _, err := ParsePlaylist("bad.m3u", []byte("/tmp/song.mp3\n"), allowAll); err == nil {
+		t.Error("Expected error for a playlist without http(s) tracks")
+	}
+
+	if _, err := ParsePlaylist("bad.json", []byte("{not json"), allowAll); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
+
+func TestParsePlaylistRejectsPrivateAddresses(t *testing.T) {
+	data := `{"name": "sneaky", "tracks": [
+		{"Title": "Metadata", "URL": "http://169.254.169.254/latest/meta-data/", "Live": true},
+		{"Title": "Internal", "URL": "http://10.0.0.5:8080/admin", "Live": true},
+		{"Title": "Local", "URL": "http://localhost:6379/", "Live": true},
+		{"Title": "Radio", "URL": "https://203.0.113.7/stream", "Live": true}
+	]}`
+
+	pl, err := ParsePlaylist("sneaky.json", []byte(data), security.ValidateURL)
+	if err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+
+	if len(pl.Tracks) != 1 || pl.Tracks[0].URL != "https://203.0.113.7/stream" {
+		t.Fatalf("Expected only the public track to be kept, got %v", pl.Tracks)
+	}
+	if pl.Tracks[0].Live {
+		t.Error("Expected the imported track not to be live")
+	}
+
+	if _, err := ParsePlaylist("private.json", []byte(`{"tracks": [{"URL": "http://192.168.1.1/", "Live": true}]}`), security.ValidateURL); err == nil {
+		t.Error("Expected error for a playlist with only private addresses")
+	}
+}
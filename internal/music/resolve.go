@@ -0,0 +1,109 @@
+package music
+
+import (
+	"fmt"
+	"time"
+)
+
+// StreamResolver looks up the media URL ffmpeg should read a track from,
+// for tracks that don't have one, e.g. after they were restored from disk
+// or loaded from a saved playlist.
+type StreamResolver interface {
+	Resolve(track *Track) (string, error)
+}
+
+// StreamResolverFunc adapts a function to the StreamResolver interface.
+type StreamResolverFunc func(track *Track) (string, error)
+
+func (f StreamResolverFunc) Resolve(track *Track) (string, error) {
+	return f(track)
+}
+
+func (p *Player) SetStreamResolver(resolver StreamResolver) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.resolver = resolver
+}
+
+// needsStreamLocked reports whether track must be resolved before it can
+// be opened. Live streams are played from their URL as is.
+func (p *Player) needsStreamLocked(track *Track) bool {
+	return p.resolver != nil && track.StreamURL == "" && !track.Live
+}
+
+// resolveLocked starts looking up track's stream URL without holding the
+// lock, since yt-dlp can take seconds. The track starts at offset once
+// the URL is known, if it is still current by then.
+func (p *Player) resolveLocked(track *Track, offset time.Duration) {
+	p.resumeAt = offset
+	if p.resolving == track {
+		return
+	}
+
+	p.resolving = track
+	go p.resolveStream(track, p.resolver)
+}
+
+func (p *Player) resolveStream(track *Track, resolver StreamResolver) {
+	defer p.flushEvents()
+	streamURL, err := resolver.Resolve(track)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil {
+		track.StreamURL = streamURL
+	}
+
+	if p.resolving != track {
+		return
+	}
+	p.resolving = nil
+
+	// Skipped, stopped or already streaming in the meantime
+	if p.Current != track || p.stream != nil {
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to resolve stream: %w", err)
+	} else {
+		err = p.startLocked(track, p.resumeAt)
+	}
+	if err != nil {
+		p.emitLocked(Event{Type: EventError, Track: track, Err: err})
+		p.emitLocked(Event{Type: EventTrackEnded, Track: track})
+		p.advanceLocked(track, true)
+		return
+	}
+
+	// Paused while the URL was looked up
+	if p.stream != nil && !p.Playing {
+		p.stream.paused = true
+	}
+}
+
+// resolveNext looks up the stream URL of the track a transition leads
+// into. It runs without the lock, from the goroutine preparing the
+// transition.
+func (p *Player) resolveNext(next *Track, resolver StreamResolver) error {
+	p.mu.Lock()
+	needed := resolver != nil && next.StreamURL == "" && !next.Live
+	p.mu.Unlock()
+
+	if !needed {
+		return nil
+	}
+
+	streamURL, err := resolver.Resolve(next)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	next.StreamURL = streamURL
+	p.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package music
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlayerResolvesStreamWithoutLock(t *testing.T) {
+	player, sink, source := newTestPlayer(100000)
+
+	started := make(chan *Track, 1)
+	release := make(chan struct{})
+	player.SetStreamResolver(StreamResolverFunc(func(track *Track) (string, error) {
+		started <- track
+		<-release
+		return "https://cdn.example.com/" + track.ID, nil
+	}))
+
+	track := &Track{ID: "abc", Title: "Song 1", URL: "https://youtube.com/watch?v=abc"}
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(track)
+	if err := player.Play(); err != nil {
+		t.Fatalf("Failed to play: %v", err)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the stream URL to be looked up")
+	}
+
+	// Other commands go through while the lookup is still running
+	done := make(chan struct{})
+	go func() {
+		player.AddToQueue(&Track{Title: "Song 2", URL: "url2"})
+		player.GetQueue()
+		player.Position()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the player not to be locked during the lookup")
+	}
+
+	if source.openCount() != 0 {
+		t.Errorf("Expected no stream before the URL is known, got %d", source.openCount())
+	}
+
+	close(release)
+	receiveFrame(t, sink)
+
+	if track.StreamURL != "https://cdn.example.com/abc" {
+		t.Errorf("Expected stream URL to be resolved, got %q", track.StreamURL)
+	}
+
+	// Tracks that already have a stream URL, and live streams, are left alone
+	player.AddNext(&Track{Title: "Radio", URL: "https://radio.example.com/stream", Live: true})
+	player.Skip()
+	receiveFrame(t, sink)
+
+	select {
+	case track := <-started:
+		t.Errorf("Expected no lookup for %q", track.Title)
+	default:
+	}
+}
+
+func TestPlayerResolveFailureMovesOn(t *testing.T) {
+	player, sink, _ := newTestPlayer(100000)
+
+	var mu sync.Mutex
+	var events []Event
+	player.Subscribe(func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+
+	player.SetStreamResolver(StreamResolverFunc(func(track *Track) (string, error) {
+		return "", fmt.Errorf("video unavailable")
+	}))
+
+	good := &Track{Title: "Song 2", URL: "url2", StreamURL: "https://cdn.example.com/2"}
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.AddToQueue(good)
+	player.Play()
+
+	receiveFrame(t, sink)
+	if current := player.GetCurrentTrack(); current != good {
+		t.Errorf("Expected the player to move on to Song 2, got %v", current)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var sawError bool
+	for _, event := range events {
+		if event.Type == EventError && event.Track.Title == "Song 1" {
+			sawError = true
+		}
+	}
+	if !sawError {
+		t.Errorf("Expected an error event for Song 1, got %v", events)
+	}
+}
+
+func TestPlayerSkipWhileResolving(t *testing.T) {
+	player, sink, source := newTestPlayer(100000)
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	player.SetStreamResolver(StreamResolverFunc(func(track *Track) (string, error) {
+		started <- struct{}{}
+		<-release
+		return "https://cdn.example.com/1", nil
+	}))
+
+	second := &Track{Title: "Song 2", URL: "url2", StreamURL: "https://cdn.example.com/2"}
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.AddToQueue(second)
+	player.Play()
+	<-started
+
+	player.Skip()
+	receiveFrame(t, sink)
+
+	// The late lookup must not take over from the track skipped to
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+
+	if current := player.GetCurrentTrack(); current != second {
+		t.Errorf("Expected Song 2 to keep playing, got %v", current)
+	}
+	if source.openCount() != 1 {
+		t.Errorf("Expected only Song 2 to be opened, got %d streams", source.openCount())
+	}
+}
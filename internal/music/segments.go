@@ -0,0 +1,180 @@
+package music
+
+import (
+	"sort"
+	"time"
+)
+
+// minSegmentSkip is the shortest stretch worth jumping over. Skipping
+// less than this is more jarring than just playing it.
+const minSegmentSkip = time.Second
+
+// Segment is a stretch of a track that playback jumps over, such as a
+// sponsor read or silence at either end.
+type Segment struct {
+	Start    time.Duration
+	End      time.Duration
+	Category string // e.g. "sponsor", "intro" or "silence"
+}
+
+// SegmentSource finds the segments of a track to skip.
+type SegmentSource interface {
+	Segments(track *Track) ([]Segment, error)
+}
+
+// SegmentSourceFunc adapts a function to the SegmentSource interface.
+type SegmentSourceFunc func(track *Track) ([]Segment, error)
+
+func (f SegmentSourceFunc) Segments(track *Track) ([]Segment, error) {
+	return f(track)
+}
+
+// CombineSegments asks every source for segments and merges what they
+// find. A source failing only matters if none of them found anything.
+func CombineSegments(sources ...SegmentSource) SegmentSource {
+	return SegmentSourceFunc(func(track *Track) ([]Segment, error) {
+		var segments []Segment
+		var firstErr error
+		for _, source := range sources {
+			found, err := source.Segments(track)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			segments = append(segments, found...)
+		}
+
+		if len(segments) == 0 {
+			return nil, firstErr
+		}
+		return mergeSegments(segments), nil
+	})
+}
+
+// mergeSegments sorts segments and joins the ones that overlap, keeping
+// the category of whichever starts first
+func mergeSegments(segments []Segment) []Segment {
+	sorted := make([]Segment, 0, len(segments))
+	for _, segment := range segments {
+		if segment.End > segment.Start {
+			sorted = append(sorted, segment)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	var merged []Segment
+	for _, segment := range sorted {
+		if last := len(merged) - 1; last >= 0 && segment.Start <= merged[last].End {
+			if segment.End > merged[last].End {
+				merged[last].End = segment.End
+			}
+			continue
+		}
+		merged = append(merged, segment)
+	}
+
+	return merged
+}
+
+// SetSegmentSource sets where the player looks up segments to skip.
+// A nil source turns skipping off entirely.
+func (p *Player) SetSegmentSource(source SegmentSource) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.segmentSource = source
+}
+
+// SetSkipSegments toggles skipping segments, looking them up for the
+// current track if it is turned on mid-track.
+func (p *Player) SetSkipSegments(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.skipSegments = enabled
+	if enabled && p.Current != nil {
+		p.findSegmentsLocked(p.Current)
+	}
+}
+
+func (p *Player) IsSkippingSegments() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.skipSegments
+}
+
+// GetSegments returns the segments found in the current track so far.
+func (p *Player) GetSegments() []Segment {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.segmentsFor != p.Current {
+		return nil
+	}
+	return append([]Segment(nil), p.segments...)
+}
+
+// findSegmentsLocked starts looking up the segments of track, unless
+// they already are known or skipping is off.
+func (p *Player) findSegmentsLocked(track *Track) {
+	if p.segmentSource == nil || !p.skipSegments || track.Live || track == p.segmentsFor {
+		return
+	}
+
+	p.segmentsFor = track
+	p.segments = nil
+	go p.lookupSegments(track, p.segmentSource)
+}
+
+// lookupSegments runs the segment source without holding the lock, which
+// can take a while, and keeps the result if track is still current.
+func (p *Player) lookupSegments(track *Track, source SegmentSource) {
+	segments, err := source.Segments(track)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.segmentsFor == track {
+		p.segments = mergeSegments(segments)
+	}
+}
+
+// skipSegmentLocked runs after every frame pb sends. Once playback is in
+// a segment it jumps to the segment's end, or ends the track if the
+// segment runs to the end. It reports whether pb has stopped.
+func (p *Player) skipSegmentLocked(pb *playback) bool {
+	// Streams carrying a transition already play into the next track
+	if p.stream != pb || pb.next != nil || !p.skipSegments || p.segmentsFor != pb.track {
+		return false
+	}
+
+	position := p.positionLocked()
+	for _, segment := range p.segments {
+		if position < segment.Start || position >= segment.End-minSegmentSkip {
+			continue
+		}
+
+		skipped := segment
+		p.emitLocked(Event{Type: EventSegmentSkipped, Track: pb.track, Segment: &skipped})
+
+		track := pb.track
+		if track.Duration > 0 && segment.End >= track.Duration-minSegmentSkip {
+			// Nothing worth hearing is left, so the track is over
+			p.stopLocked()
+			p.emitLocked(Event{Type: EventTrackEnded, Track: track})
+			p.advanceLocked(track, false)
+			return true
+		}
+
+		// A failed restart has already moved on to the next track
+		p.restartLocked(segment.End)
+		return true
+	}
+
+	return false
+}
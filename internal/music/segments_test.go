@@ -0,0 +1,152 @@
+package music
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCombineSegments(t *testing.T) {
+	sponsor := SegmentSourceFunc(func(track *Track) ([]Segment, error) {
+		return []Segment{
+			{Start: 60 * time.Second, End: 90 * time.Second, Category: "sponsor"},
+			{Start: 10 * time.Second, End: 20 * time.Second, Category: "intro"},
+		}, nil
+	})
+	silence := SegmentSourceFunc(func(track *Track) ([]Segment, error) {
+		return []Segment{
+			{Start: 0, End: 12 * time.Second, Category: "silence"},
+			{Start: 5 * time.Second, End: 5 * time.Second, Category: "empty"},
+		}, nil
+	})
+	failing := SegmentSourceFunc(func(track *Track) ([]Segment, error) {
+		return nil, errors.New("offline")
+	})
+
+	segments, err := CombineSegments(sponsor, failing, silence).Segments(&Track{})
+	if err != nil {
+		t.Fatalf("Expected segments despite one source failing, got %v", err)
+	}
+
+	expected := []Segment{
+		{Start: 0, End: 20 * time.Second, Category: "silence"},
+		{Start: 60 * time.Second, End: 90 * time.Second, Category: "sponsor"},
+	}
+	if len(segments) != len(expected) {
+		t.Fatalf("Expected %d segments, got %v", len(expected), segments)
+	}
+	for i, want := range expected {
+		if segments[i] != want {
+			t.Errorf("Segment %d: expected %+v, got %+v", i, want, segments[i])
+		}
+	}
+
+	if _, err := CombineSegments(failing).Segments(&Track{}); err == nil {
+		t.Error("Expected the source error when nothing was found, got nil")
+	}
+}
+
+func TestPlayerSkipsSegments(t *testing.T) {
+	player, sink, source := newTestPlayer(100000)
+
+	var mu sync.Mutex
+	var events []Event
+	player.Subscribe(func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+
+	player.SetSegmentSource(SegmentSourceFunc(func(track *Track) ([]Segment, error) {
+		return []Segment{
+			{Start: 500 * time.Millisecond, End: 5 * time.Second, Category: "intro"},
+			{Start: 6 * time.Second, End: 30 * time.Second, Category: "silence"},
+		}, nil
+	}))
+	player.SetSkipSegments(true)
+
+	track := &Track{Title: "Song 1", URL: "url1", Duration: 30 * time.Second}
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(track)
+	player.Play()
+
+	waitFor(t, func() bool { return len(player.GetSegments()) == 2 })
+
+	// The intro is jumped over as soon as playback reaches it
+	playUntil(t, player, sink, 5*time.Second)
+
+	source.mu.Lock()
+	start := source.opened[len(source.opened)-1].Start
+	source.mu.Unlock()
+
+	if start != 5*time.Second {
+		t.Errorf("Expected stream to restart at the end of the intro, got %v", start)
+	}
+
+	// Silence running to the end finishes the track
+	deadline := time.Now().Add(time.Second)
+	for player.GetCurrentTrack() != nil && time.Now().Before(deadline) {
+		select {
+		case <-sink.frames:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if player.GetCurrentTrack() != nil {
+		t.Fatalf("Expected the track to end at the trailing silence, still at %v", player.Position())
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) >= 5
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var types []EventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	if len(types) != 5 || types[1] != EventSegmentSkipped || types[2] != EventSegmentSkipped || types[3] != EventTrackEnded || types[4] != EventQueueEmpty {
+		t.Errorf("Expected TrackStarted, two SegmentSkipped, TrackEnded and QueueEmpty, got %v", types)
+	}
+	if events[1].Segment == nil || events[1].Segment.Category != "intro" {
+		t.Errorf("Expected the intro to be skipped first, got %+v", events[1].Segment)
+	}
+}
+
+func TestPlayerKeepsSegmentsWhenDisabled(t *testing.T) {
+	player, sink, source := newTestPlayer(100000)
+
+	lookups := make(chan *Track, 1)
+	player.SetSegmentSource(SegmentSourceFunc(func(track *Track) ([]Segment, error) {
+		lookups <- track
+		return []Segment{{Start: 0, End: 5 * time.Second, Category: "silence"}}, nil
+	}))
+
+	if player.IsSkippingSegments() {
+		t.Error("Expected skipping to be off by default")
+	}
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1", Duration: 30 * time.Second})
+	player.Play()
+
+	playUntil(t, player, sink, time.Second)
+	if source.openCount() != 1 || len(lookups) != 0 {
+		t.Errorf("Expected no lookup or restart with skipping off, got %d streams and %d lookups", source.openCount(), len(lookups))
+	}
+
+	// Turning it on mid-track looks the current track up and skips
+	player.SetSkipSegments(true)
+	waitFor(t, func() bool { return len(player.GetSegments()) == 1 })
+	playUntil(t, player, sink, 5*time.Second)
+
+	if source.openCount() != 2 {
+		t.Errorf("Expected the stream to restart past the silence, got %d streams", source.openCount())
+	}
+
+	player.Stop()
+}
@@ -0,0 +1,89 @@
+package music
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// GuildSettings are a guild's playback preferences. Unlike PlayerState
+// they are kept when the player is torn down, so they apply again the
+// next time something is played.
+type GuildSettings struct {
+	Normalize    bool       `json:"normalize"`
+	Transition   Transition `json:"transition"`
+	SkipSegments bool       `json:"skip_segments"`
+}
+
+// SettingsStore keeps one JSON file of settings per guild in a directory.
+type SettingsStore struct {
+	Dir string
+}
+
+func NewSettingsStore(dir string) *SettingsStore {
+	return &SettingsStore{Dir: dir}
+}
+
+func (s *SettingsStore) path(guildID string) string {
+	return filepath.Join(s.Dir, guildID+".json")
+}
+
+// Get reads the guild's settings. Guilds that never changed anything get
+// the defaults.
+func (s *SettingsStore) Get(guildID string) (GuildSettings, error) {
+	var settings GuildSettings
+
+	data, err := os.ReadFile(s.path(guildID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return settings, fmt.Errorf("failed to read settings: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return GuildSettings{}, fmt.Errorf("failed to parse settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+func (s *SettingsStore) Save(guildID string, settings GuildSettings) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create settings directory: %w", err)
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file
+	tmp := s.path(guildID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+
+	if err := os.Rename(tmp, s.path(guildID)); err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+	return nil
+}
+
+// applySettings brings the player in line with settings, restarting the
+// stream only if normalization changed.
+func (p *Player) applySettings(settings GuildSettings) error {
+	if err := p.SetTransition(settings.Transition); err != nil {
+		return err
+	}
+
+	if p.IsSkippingSegments() != settings.SkipSegments {
+		p.SetSkipSegments(settings.SkipSegments)
+	}
+
+	if p.IsNormalized() != settings.Normalize {
+		return p.SetNormalize(settings.Normalize)
+	}
+	return nil
+}
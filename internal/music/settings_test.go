@@ -0,0 +1,97 @@
+package music
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettingsStore(t *testing.T) {
+	store := NewSettingsStore(t.TempDir())
+
+	settings, err := store.Get("guild1")
+	if err != nil {
+		t.Fatalf("Failed to get settings: %v", err)
+	}
+	if settings != (GuildSettings{}) {
+		t.Errorf("Expected default settings for a new guild, got %+v", settings)
+	}
+
+	saved := GuildSettings{
+		Normalize:    true,
+		Transition:   Transition{Enabled: true, Crossfade: 5 * time.Second},
+		SkipSegments: true,
+	}
+	if err := store.Save("guild1", saved); err != nil {
+		t.Fatalf("Failed to save settings: %v", err)
+	}
+
+	settings, err = store.Get("guild1")
+	if err != nil {
+		t.Fatalf("Failed to get settings: %v", err)
+	}
+	if settings != saved {
+		t.Errorf("Expected %+v, got %+v", saved, settings)
+	}
+}
+
+func TestManagerKeepsSettings(t *testing.T) {
+	store := NewSettingsStore(t.TempDir())
+	manager := NewManager(nil, &fakeSource{}, time.Minute)
+	manager.SetSettingsStore(store)
+
+	crossfade := Transition{Enabled: true, Crossfade: 3 * time.Second}
+	err := manager.UpdateSettings("guild1", func(settings *GuildSettings) {
+		settings.Normalize = true
+		settings.Transition = crossfade
+	})
+	if err != nil {
+		t.Fatalf("Failed to update settings: %v", err)
+	}
+
+	if _, ok := manager.Lookup("guild1"); ok {
+		t.Error("Expected changing settings not to create a player")
+	}
+
+	player := manager.Get("guild1")
+	if !player.IsNormalized() || player.GetTransition() != crossfade {
+		t.Errorf("Expected new player to get the guild's settings, got normalize %v and %s", player.IsNormalized(), player.GetTransition())
+	}
+
+	// Changes reach a player that already exists
+	manager.UpdateSettings("guild1", func(settings *GuildSettings) {
+		settings.Normalize = false
+	})
+	if player.IsNormalized() {
+		t.Error("Expected the player to stop normalizing once turned off")
+	}
+	manager.UpdateSettings("guild1", func(settings *GuildSettings) {
+		settings.Normalize = true
+		settings.SkipSegments = true
+	})
+	if !player.IsNormalized() || !player.IsSkippingSegments() {
+		t.Error("Expected the player to normalize and skip segments once turned on")
+	}
+
+	// Settings outlive the player
+	manager.Remove("guild1")
+	player = manager.Get("guild1")
+	if !player.IsNormalized() || player.GetTransition() != crossfade || !player.IsSkippingSegments() {
+		t.Error("Expected a player created after Remove to keep the settings")
+	}
+
+	// And a restart
+	restarted := NewManager(nil, &fakeSource{}, time.Minute)
+	restarted.SetSettingsStore(store)
+	if settings := restarted.Settings("guild1"); !settings.Normalize || settings.Transition != crossfade || !settings.SkipSegments {
+		t.Errorf("Expected settings to be loaded from the store, got %+v", settings)
+	}
+
+	if err := manager.UpdateSettings("guild1", func(settings *GuildSettings) {
+		settings.Transition.Crossfade = time.Hour
+	}); err == nil {
+		t.Error("Expected an overlong crossfade to be refused")
+	}
+	if manager.Settings("guild1").Transition != crossfade {
+		t.Error("Expected refused settings not to be kept")
+	}
+}
@@ -0,0 +1,162 @@
+package music
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// silenceEdge is how close to the start or end of a track silence has to
+// reach to count as leading or trailing silence.
+const silenceEdge = 500 * time.Millisecond
+
+// SilenceDetector finds silence at the start and end of tracks with
+// ffmpeg's silencedetect filter. Only a window at each end is analysed,
+// so long tracks don't have to be downloaded in full.
+type SilenceDetector struct {
+	Path        string        // ffmpeg binary, defaults to "ffmpeg"
+	Noise       string        // Level below which audio counts as silent, defaults to "-50dB"
+	MinDuration time.Duration // Shortest silence worth trimming, defaults to 1s
+	Window      time.Duration // How much of each end to analyse, defaults to 30s
+}
+
+func NewSilenceDetector() *SilenceDetector {
+	return &SilenceDetector{
+		Path:        "ffmpeg",
+		Noise:       "-50dB",
+		MinDuration: time.Second,
+		Window:      30 * time.Second,
+	}
+}
+
+// silence is a silent stretch reported by silencedetect. End is negative
+// when the silence lasted until the end of the input.
+type silence struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Segments returns the track's leading and trailing silence, if any.
+// Tracks of unknown length are left alone.
+func (d *SilenceDetector) Segments(track *Track) ([]Segment, error) {
+	if track.Live || track.Duration <= 0 {
+		return nil, nil
+	}
+
+	window := d.Window
+	if window <= 0 {
+		window = 30 * time.Second
+	}
+	if window > track.Duration {
+		window = track.Duration
+	}
+
+	var segments []Segment
+
+	head, err := d.detect(track, 0, window)
+	if err != nil {
+		return nil, err
+	}
+	if len(head) > 0 && head[0].Start <= silenceEdge {
+		end := head[0].End
+		if end < 0 {
+			end = window
+		}
+		segments = append(segments, Segment{Start: 0, End: end, Category: "silence"})
+	}
+
+	// Short tracks fit in one window, which was just analysed
+	tailStart := track.Duration - window
+	tail := head
+	if tailStart > 0 {
+		if tail, err = d.detect(track, tailStart, window); err != nil {
+			return nil, err
+		}
+	}
+	if len(tail) > 0 {
+		last := tail[len(tail)-1]
+		if last.End < 0 || last.End >= window-silenceEdge {
+			segments = append(segments, Segment{Start: tailStart + last.Start, End: track.Duration, Category: "silence"})
+		}
+	}
+
+	return mergeSegments(segments), nil
+}
+
+// detect runs silencedetect over length of track from start. The times
+// it reports are relative to start.
+func (d *SilenceDetector) detect(track *Track, start, length time.Duration) ([]silence, error) {
+	path := d.Path
+	if path == "" {
+		path = "ffmpeg"
+	}
+	noise := d.Noise
+	if noise == "" {
+		noise = "-50dB"
+	}
+	minDuration := d.MinDuration
+	if minDuration <= 0 {
+		minDuration = time.Second
+	}
+
+	args := []string{"-hide_banner", "-nostats", "-loglevel", "info"}
+	args = append(args, inputArgs(track, start)...)
+	args = append(args,
+		"-t", formatSeconds(length),
+		"-vn",
+		"-af", fmt.Sprintf("silencedetect=n=%s:d=%s", noise, formatSeconds(minDuration)),
+		"-f", "null",
+		"-",
+	)
+
+	output, err := exec.Command(path, args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("silence detection failed: %v", err)
+	}
+
+	return parseSilences(string(output)), nil
+}
+
+var (
+	silenceStartPattern = regexp.MustCompile(`silence_start: (-?[0-9.]+)`)
+	silenceEndPattern   = regexp.MustCompile(`silence_end: (-?[0-9.]+)`)
+)
+
+// parseSilences reads the silence_start and silence_end lines that
+// silencedetect logs, in order
+func parseSilences(output string) []silence {
+	var silences []silence
+
+	starts := silenceStartPattern.FindAllStringSubmatchIndex(output, -1)
+	ends := silenceEndPattern.FindAllStringSubmatchIndex(output, -1)
+
+	for i, start := range starts {
+		s := silence{Start: parseSeconds(output[start[2]:start[3]]), End: -1}
+		if s.Start < 0 {
+			s.Start = 0
+		}
+
+		// The matching end comes after this start and before the next one
+		next := len(output)
+		if i+1 < len(starts) {
+			next = starts[i+1][0]
+		}
+		for _, end := range ends {
+			if end[0] > start[0] && end[0] < next {
+				s.End = parseSeconds(output[end[2]:end[3]])
+				break
+			}
+		}
+
+		silences = append(silences, s)
+	}
+
+	return silences
+}
+
+func parseSeconds(s string) time.Duration {
+	seconds, _ := strconv.ParseFloat(s, 64)
+	return secondsDuration(seconds)
+}
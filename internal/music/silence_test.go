@@ -0,0 +1,36 @@
+package music
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSilences(t *testing.T) {
+	output := `Input #0, mp3, from 'song.mp3':
+[silencedetect @ 0x55d5c7a0] silence_start: -0.00133333
+[silencedetect @ 0x55d5c7a0] silence_end: 2.5 | silence_duration: 2.50133
+[silencedetect @ 0x55d5c7a0] silence_start: 12.25
+[silencedetect @ 0x55d5c7a0] silence_end: 13.75 | silence_duration: 1.5
+[silencedetect @ 0x55d5c7a0] silence_start: 27.1
+size=N/A time=00:00:30.00 bitrate=N/A speed= 120x`
+
+	silences := parseSilences(output)
+
+	expected := []silence{
+		{Start: 0, End: 2500 * time.Millisecond},
+		{Start: 12250 * time.Millisecond, End: 13750 * time.Millisecond},
+		{Start: 27100 * time.Millisecond, End: -1},
+	}
+	if len(silences) != len(expected) {
+		t.Fatalf("Expected %d silences, got %v", len(expected), silences)
+	}
+	for i, want := range expected {
+		if silences[i] != want {
+			t.Errorf("Silence %d: expected %+v, got %+v", i, want, silences[i])
+		}
+	}
+
+	if silences := parseSilences("no silence here"); len(silences) != 0 {
+		t.Errorf("Expected no silences, got %v", silences)
+	}
+}
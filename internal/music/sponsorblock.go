@@ -0,0 +1,101 @@
+package music
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultSponsorBlockCategories are the kinds of segments skipped when no
+// others are configured: everything that isn't the music itself.
+var DefaultSponsorBlockCategories = []string{"sponsor", "selfpromo", "interaction", "intro", "outro", "music_offtopic"}
+
+// SponsorBlock finds the segments of YouTube videos that viewers marked
+// as sponsor reads, intros and the like, using the SponsorBlock API.
+type SponsorBlock struct {
+	BaseURL    string
+	Categories []string
+	Client     *http.Client
+}
+
+func NewSponsorBlock(baseURL string, categories []string) *SponsorBlock {
+	if len(categories) == 0 {
+		categories = DefaultSponsorBlockCategories
+	}
+
+	return &SponsorBlock{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Categories: categories,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type sponsorBlockSegment struct {
+	Segment    [2]float64 `json:"segment"`
+	Category   string     `json:"category"`
+	ActionType string     `json:"actionType"`
+}
+
+// Segments looks up the track by its video ID. Tracks without one have
+// no segments.
+func (s *SponsorBlock) Segments(track *Track) ([]Segment, error) {
+	if track.ID == "" || track.Live {
+		return nil, nil
+	}
+
+	categories, err := json.Marshal(s.Categories)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("videoID", track.ID)
+	params.Set("categories", string(categories))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(s.BaseURL + "/api/skipSegments?" + params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch segments: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The API answers 404 for videos nobody has submitted segments for
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch segments: %s", resp.Status)
+	}
+
+	var found []sponsorBlockSegment
+	if err := json.NewDecoder(resp.Body).Decode(&found); err != nil {
+		return nil, fmt.Errorf("failed to parse segments: %w", err)
+	}
+
+	// Other actions mute or only highlight a segment
+	var segments []Segment
+	for _, segment := range found {
+		if segment.ActionType != "" && segment.ActionType != "skip" {
+			continue
+		}
+
+		segments = append(segments, Segment{
+			Start:    secondsDuration(segment.Segment[0]),
+			End:      secondsDuration(segment.Segment[1]),
+			Category: segment.Category,
+		})
+	}
+
+	return segments, nil
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,60 @@
+package music
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSponsorBlock(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/skipSegments" || r.URL.Query().Get("videoID") != "abc" {
+			http.NotFound(w, r)
+			return
+		}
+
+		query = r.URL.Query().Get("categories")
+		w.Write([]byte(`[
+			{"segment": [0, 12.5], "category": "intro", "actionType": "skip"},
+			{"segment": [30, 40], "category": "sponsor", "actionType": "mute"},
+			{"segment": [200, 215.25], "category": "outro"}
+		]`))
+	}))
+	defer server.Close()
+
+	sponsorBlock := NewSponsorBlock(server.URL+"/", []string{"intro", "outro"})
+
+	segments, err := sponsorBlock.Segments(&Track{ID: "abc"})
+	if err != nil {
+		t.Fatalf("Failed to get segments: %v", err)
+	}
+
+	if query != `["intro","outro"]` {
+		t.Errorf("Expected categories to be sent as a JSON list, got %s", query)
+	}
+
+	expected := []Segment{
+		{Start: 0, End: 12500 * time.Millisecond, Category: "intro"},
+		{Start: 200 * time.Second, End: 215250 * time.Millisecond, Category: "outro"},
+	}
+	if len(segments) != len(expected) {
+		t.Fatalf("Expected %d segments, got %v", len(expected), segments)
+	}
+	for i, want := range expected {
+		if segments[i] != want {
+			t.Errorf("Segment %d: expected %+v, got %+v", i, want, segments[i])
+		}
+	}
+
+	// Videos nobody submitted segments for have none
+	segments, err = sponsorBlock.Segments(&Track{ID: "unknown"})
+	if err != nil || len(segments) != 0 {
+		t.Errorf("Expected no segments for an unknown video, got %v (%v)", segments, err)
+	}
+
+	if segments, _ := sponsorBlock.Segments(&Track{URL: "https://example.com/song.mp3"}); len(segments) != 0 {
+		t.Errorf("Expected no segments for a track without an ID, got %v", segments)
+	}
+}
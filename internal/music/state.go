@@ -0,0 +1,161 @@
+package music
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PlayerState is what a guild's player needs to pick up where it left off
+// after a restart.
+type PlayerState struct {
+	VoiceChannelID string        `json:"voice_channel_id"`
+	Current        *Track        `json:"current,omitempty"`
+	Position       time.Duration `json:"position"`
+	Paused         bool          `json:"paused"`
+	Queue          []*Track      `json:"queue"`
+	Loop           LoopMode      `json:"loop"`
+	Volume         float64       `json:"volume"`
+	Filters        FilterSet     `json:"filters"`
+	Autoplay       bool          `json:"autoplay"`
+}
+
+// Empty reports whether there is nothing worth restoring.
+func (s PlayerState) Empty() bool {
+	return s.Current == nil && len(s.Queue) == 0
+}
+
+// StateStore keeps one JSON file per guild in a directory.
+type StateStore struct {
+	Dir string
+}
+
+func NewStateStore(dir string) *StateStore {
+	return &StateStore{Dir: dir}
+}
+
+func (s *StateStore) path(guildID string) string {
+	return filepath.Join(s.Dir, guildID+".json")
+}
+
+func (s *StateStore) Save(guildID string, state PlayerState) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode player state: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file
+	tmp := s.path(guildID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write player state: %w", err)
+	}
+
+	return os.Rename(tmp, s.path(guildID))
+}
+
+func (s *StateStore) Delete(guildID string) error {
+	err := os.Remove(s.path(guildID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Load reads every saved guild state. Unreadable files are skipped.
+func (s *StateStore) Load() (map[string]PlayerState, error) {
+	states := make(map[string]PlayerState)
+
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return states, nil
+		}
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.Dir, name))
+		if err != nil {
+			continue
+		}
+
+		var state PlayerState
+		if err := json.Unmarshal(data, &state); err != nil {
+			continue
+		}
+
+		states[strings.TrimSuffix(name, ".json")] = state
+	}
+
+	return states, nil
+}
+
+// Snapshot captures the player's queue and playback state.
+func (p *Player) Snapshot() PlayerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := PlayerState{
+		VoiceChannelID: p.voiceConn.ChannelID,
+		Current:        p.Current,
+		Queue:          append([]*Track(nil), p.Queue...),
+		Loop:           p.loop,
+		Volume:         p.volume,
+		Filters:        p.filters,
+		Autoplay:       p.autoplay,
+	}
+
+	if p.Current != nil {
+		state.Paused = !p.Playing
+		if !p.Current.Live {
+			state.Position = p.positionLocked()
+		}
+	}
+
+	return state
+}
+
+// Restore replaces the player's queue and settings with a saved state.
+// Guild settings are left alone, the manager applies those.
+// The current track resumes at its saved position once the player is
+// connected to voice, unless it was paused.
+func (p *Player) Restore(state PlayerState) {
+	defer p.flushEvents()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stopLocked()
+	p.Queue = append([]*Track(nil), state.Queue...)
+	p.unshuffled = nil
+	p.loop = state.Loop
+	p.volume = state.Volume
+	if p.volume < 0.0 || p.volume > 1.0 {
+		p.volume = 1.0
+	}
+
+	p.filters = state.Filters
+	p.autoplay = state.Autoplay
+
+	p.Current = state.Current
+	p.Playing = state.Current != nil && !state.Paused
+	p.resumeAt = state.Position
+	p.skipVotes = nil
+
+	if p.Playing {
+		if err := p.startLocked(p.Current, p.resumeAt); err != nil {
+			p.emitLocked(Event{Type: EventError, Track: p.Current, Err: err})
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package music
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateStoreSaveLoadDelete(t *testing.T) {
+	store := NewStateStore(filepath.Join(t.TempDir(), "music"))
+
+	states, err := store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load from missing directory: %v", err)
+	}
+	if len(states) != 0 {
+		t.Errorf("Expected no states, got %d", len(states))
+	}
+
+	state := PlayerState{
+		VoiceChannelID: "voice",
+		Current:        &Track{ID: "id1", Title: "Song 1", URL: "url1", Duration: 3 * time.Minute, StreamURL: "expiring", ChannelID: "text"},
+		Position:       90 * time.Second,
+		Queue:          []*Track{{Title: "Song 2", URL: "url2"}},
+		Loop:           LoopQueue,
+		Volume:         0.5,
+	}
+
+	if err := store.Save("guild1", state); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	// Broken files are skipped rather than failing the whole load
+	os.WriteFile(filepath.Join(store.Dir, "broken.json"), []byte("{"), 0644)
+
+	states, err = store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load states: %v", err)
+	}
+
+	if len(states) != 1 {
+		t.Fatalf("Expected 1 state, got %d", len(states))
+	}
+
+	loaded := states["guild1"]
+	if loaded.VoiceChannelID != "voice" || loaded.Position != 90*time.Second || loaded.Loop != LoopQueue || loaded.Volume != 0.5 {
+		t.Errorf("Expected state to round-trip, got %+v", loaded)
+	}
+
+	if loaded.Current == nil || loaded.Current.Title != "Song 1" || loaded.Current.Duration != 3*time.Minute || loaded.Current.ChannelID != "text" {
+		t.Errorf("Expected current track to round-trip, got %+v", loaded.Current)
+	}
+
+	if loaded.Current != nil && loaded.Current.StreamURL != "" {
+		t.Errorf("Expected stream URL not to be saved, got %q", loaded.Current.StreamURL)
+	}
+
+	if len(loaded.Queue) != 1 || loaded.Queue[0].URL != "url2" {
+		t.Errorf("Expected queue to round-trip, got %v", loaded.Queue)
+	}
+
+	if err := store.Delete("guild1"); err != nil {
+		t.Fatalf("Failed to delete state: %v", err)
+	}
+	if err := store.Delete("guild1"); err != nil {
+		t.Errorf("Expected deleting a missing state to succeed, got %v", err)
+	}
+
+	states, _ = store.Load()
+	if len(states) != 0 {
+		t.Errorf("Expected no states after delete, got %d", len(states))
+	}
+}
+
+func TestPlayerSnapshotAndRestore(t *testing.T) {
+	player, sink, _ := newTestPlayer(1000)
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1", Duration: 3 * time.Minute})
+	player.AddToQueue(&Track{Title: "Song 2", URL: "url2"})
+	player.SetLoopMode(LoopTrack)
+	player.SetVolume(0.4)
+	player.Play()
+
+	for i := 0; i < 3; i++ {
+		receiveFrame(t, sink)
+	}
+
+	state := player.Snapshot()
+	player.Stop()
+
+	if state.VoiceChannelID != "channel" || state.Current == nil || state.Current.URL != "url1" {
+		t.Fatalf("Expected snapshot of the current track in channel, got %+v", state)
+	}
+	if state.Position < 2*FrameDuration || len(state.Queue) != 1 || state.Loop != LoopTrack || state.Volume != 0.4 || state.Paused {
+		t.Errorf("Unexpected snapshot: %+v", state)
+	}
+
+	// A fresh player resumes where the snapshot left off once connected
+	state.Position = time.Minute
+	restored, restoredSink, source := newTestPlayer(1000)
+	restored.Restore(state)
+
+	if restored.Position() != time.Minute {
+		t.Errorf("Expected restored position to be 1m0s before connecting, got %v", restored.Position())
+	}
+
+	restored.ConnectToVoice("guild", "channel")
+	receiveFrame(t, restoredSink)
+
+	source.mu.Lock()
+	opts := source.opened[0]
+	source.mu.Unlock()
+
+	if opts.Start != time.Minute || opts.Volume != 0.4 {
+		t.Errorf("Expected stream to open at 1m0s with volume 0.4, got %+v", opts)
+	}
+
+	if restored.GetLoopMode() != LoopTrack || restored.GetQueueLength() != 1 || !restored.IsPlaying() {
+		t.Error("Expected loop mode, queue and playing state to be restored")
+	}
+
+	restored.Stop()
+}
+
+func TestPlayerRestorePaused(t *testing.T) {
+	player, sink, source := newTestPlayer(1000)
+
+	player.Restore(PlayerState{
+		Current:  &Track{Title: "Song 1", URL: "url1", Duration: 3 * time.Minute},
+		Position: 30 * time.Second,
+		Paused:   true,
+		Volume:   1.0,
+	})
+	player.ConnectToVoice("guild", "channel")
+
+	if player.IsPlaying() || source.openCount() != 0 {
+		t.Error("Expected paused state to stay paused after connecting")
+	}
+
+	player.Resume()
+	receiveFrame(t, sink)
+
+	source.mu.Lock()
+	start := source.opened[0].Start
+	source.mu.Unlock()
+
+	if start != 30*time.Second {
+		t.Errorf("Expected resume to start at 30s, got %v", start)
+	}
+
+	player.Stop()
+}
@@ -0,0 +1,257 @@
+package music
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxCrossfade is the longest overlap allowed between two tracks.
+const MaxCrossfade = 12 * time.Second
+
+// Transition controls how one track leads into the next.
+type Transition struct {
+	Enabled   bool          `json:"enabled"`   // Off cuts between tracks once one has ended
+	Crossfade time.Duration `json:"crossfade"` // Overlap between tracks, 0 joins them gaplessly
+}
+
+func (t Transition) String() string {
+	switch {
+	case !t.Enabled:
+		return "off"
+	case t.Crossfade <= 0:
+		return "gapless"
+	default:
+		return fmt.Sprintf("crossfade %s", FormatDuration(t.Crossfade))
+	}
+}
+
+func (t Transition) validate() error {
+	if t.Crossfade < 0 || t.Crossfade > MaxCrossfade {
+		return fmt.Errorf("crossfade must be between 0 and %s", FormatDuration(MaxCrossfade))
+	}
+	return nil
+}
+
+// Transitions are prepared transitionLead before the next track would
+// begin, and the prepared stream takes over handoffLead after that, which
+// leaves ffmpeg time to open both inputs.
+const (
+	transitionLead = 10 * time.Second
+	handoffLead    = 5 * time.Second
+)
+
+// SetTransition changes how tracks lead into each other, starting with
+// the next transition.
+func (p *Player) SetTransition(t Transition) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.transition = t
+	return nil
+}
+
+func (p *Player) GetTransition() Transition {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.transition
+}
+
+// SetNormalize toggles EBU R128 loudness normalization, restarting the
+// stream from the current position so it applies mid-track.
+func (p *Player) SetNormalize(normalize bool) error {
+	defer p.flushEvents()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.normalize = normalize
+
+	if p.stream != nil {
+		return p.restartLocked(p.positionLocked())
+	}
+
+	return nil
+}
+
+func (p *Player) IsNormalized() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.normalize
+}
+
+// transitionLocked runs after every frame pb sends. Near the end of a
+// track it prepares a second stream that carries the track into the next
+// one, and hands over to it once playback reaches the point it starts at.
+// It reports whether pb has stopped.
+func (p *Player) transitionLocked(pb *playback, sink VoiceSink) bool {
+	if p.stream != pb {
+		return false
+	}
+
+	if pb.next != nil && p.positionLocked() >= pb.switchAt {
+		return p.switchLocked(pb)
+	}
+
+	if pb.handoff != nil {
+		return p.handoffLocked(pb, sink)
+	}
+
+	if pb.prepared || !p.transition.Enabled || pb.next != nil || pb.track.Live || pb.track.Duration <= 0 {
+		return false
+	}
+
+	next := p.peekNextLocked(pb.track)
+	if next == nil || next.Live {
+		return false
+	}
+
+	crossfade := p.transition.Crossfade
+	if crossfade > pb.track.Duration {
+		crossfade = pb.track.Duration
+	}
+	switchAt := pb.track.Duration - crossfade
+
+	position := p.positionLocked()
+	if position < switchAt-transitionLead {
+		return false
+	}
+
+	pb.prepared = true
+
+	start := position + handoffLead
+	if start >= switchAt {
+		// Too late to prepare, this track ends with a plain cut
+		return false
+	}
+
+	opts := p.streamOptionsLocked(start)
+	opts.Next = next
+	opts.Crossfade = crossfade
+
+	go p.prepareTransition(pb, p.source, p.resolver, opts, switchAt)
+
+	return false
+}
+
+// prepareTransition opens the stream a transition hands over to and waits
+// for its first frame, so the handoff doesn't leave a gap.
+func (p *Player) prepareTransition(pb *playback, source AudioSource, resolver StreamResolver, opts StreamOptions, switchAt time.Duration) {
+	if err := p.resolveNext(opts.Next, resolver); err != nil {
+		return
+	}
+
+	reader, err := source.Open(pb.track, opts)
+	if err != nil {
+		return
+	}
+
+	first, err := reader.ReadFrame()
+	if err != nil {
+		reader.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stream != pb || pb.stopped {
+		reader.Close()
+		return
+	}
+
+	pb.handoff = &playback{
+		track:    pb.track,
+		reader:   &primedReader{FrameReader: reader, first: first},
+		offset:   opts.Start,
+		rate:     pb.rate,
+		next:     opts.Next,
+		switchAt: switchAt,
+	}
+}
+
+// handoffLocked replaces pb with its prepared stream once playback has
+// reached the position the prepared stream starts at.
+func (p *Player) handoffLocked(pb *playback, sink VoiceSink) bool {
+	next := pb.handoff
+	position := p.positionLocked()
+	if position < next.offset {
+		return false
+	}
+
+	// Give up if the stream became ready too late, or the queue changed
+	if position > next.offset+2*FrameDuration || p.peekNextLocked(pb.track) != next.next {
+		pb.dropHandoff()
+		return false
+	}
+
+	pb.handoff = nil
+	pb.stopped = true
+	pb.reader.Close()
+
+	p.stream = next
+	go p.run(next, sink)
+
+	return true
+}
+
+// switchLocked makes the track pb leads into current, now that its audio
+// has started.
+func (p *Player) switchLocked(pb *playback) bool {
+	finished := pb.track
+	next := pb.next
+	pb.next = nil
+
+	p.emitLocked(Event{Type: EventTrackEnded, Track: finished})
+
+	// The queue changed since the transition was prepared, so play
+	// whatever comes next now from the start
+	if p.peekNextLocked(finished) != next {
+		p.stopLocked()
+		p.advanceLocked(finished, false)
+		return true
+	}
+
+	p.requeueLocked(finished, false)
+	p.Queue = p.Queue[1:]
+	p.Current = next
+	p.resumeAt = 0
+	p.skipVotes = nil
+	p.markPlayedLocked(next)
+	p.findSegmentsLocked(next)
+
+	pb.track = next
+	pb.offset -= pb.switchAt
+	pb.prepared = false
+
+	p.emitLocked(Event{Type: EventTrackStarted, Track: next})
+
+	return false
+}
+
+func (pb *playback) dropHandoff() {
+	if pb.handoff != nil {
+		pb.handoff.reader.Close()
+		pb.handoff = nil
+	}
+}
+
+// primedReader returns a frame that was read ahead before the rest
+type primedReader struct {
+	FrameReader
+	first []byte
+}
+
+func (r *primedReader) ReadFrame() ([]byte, error) {
+	if r.first != nil {
+		frame := r.first
+		r.first = nil
+		return frame, nil
+	}
+
+	return r.FrameReader.ReadFrame()
+}
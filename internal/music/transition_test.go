@@ -0,0 +1,148 @@
+package music
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// playUntil receives frames until the player reaches position
+func playUntil(t *testing.T, player *Player, sink *fakeSink, position time.Duration) {
+	t.Helper()
+
+	for player.Position() < position {
+		receiveFrame(t, sink)
+	}
+}
+
+func hasHandoff(player *Player) bool {
+	player.mu.Lock()
+	defer player.mu.Unlock()
+
+	return player.stream != nil && player.stream.handoff != nil
+}
+
+func TestPlayerCrossfade(t *testing.T) {
+	player, sink, source := newTestPlayer(100000)
+
+	var mu sync.Mutex
+	var events []Event
+	player.Subscribe(func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+
+	if err := player.SetTransition(Transition{Enabled: true, Crossfade: time.Minute}); err == nil {
+		t.Error("Expected error for crossfade above the maximum, got nil")
+	}
+	player.SetTransition(Transition{Enabled: true, Crossfade: 2 * time.Second})
+
+	first := &Track{Title: "Song 1", URL: "url1", Duration: 30 * time.Second}
+	second := &Track{Title: "Song 2", URL: "url2", Duration: 30 * time.Second}
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(first)
+	player.AddToQueue(second)
+	player.Play()
+
+	// The transition is prepared 10s before the next track begins at 28s
+	playUntil(t, player, sink, 18*time.Second)
+	waitFor(t, func() bool { return hasHandoff(player) })
+
+	source.mu.Lock()
+	opts := source.opened[len(source.opened)-1]
+	source.mu.Unlock()
+
+	if opts.Next != second || opts.Crossfade != 2*time.Second || opts.Start != 23*time.Second {
+		t.Errorf("Expected transition stream from 23s into Song 2 with 2s crossfade, got %+v", opts)
+	}
+
+	playUntil(t, player, sink, 27*time.Second)
+	if player.GetCurrentTrack() != first {
+		t.Errorf("Expected Song 1 to still be current before the crossfade, got %s", player.GetCurrentTrack().Title)
+	}
+
+	// Song 2 becomes current as soon as its audio starts, in the same stream
+	for player.GetCurrentTrack() == first {
+		receiveFrame(t, sink)
+	}
+
+	if player.GetCurrentTrack() != second || player.GetQueueLength() != 0 {
+		t.Errorf("Expected Song 2 to be current with an empty queue, got %s and %d queued", player.GetCurrentTrack().Title, player.GetQueueLength())
+	}
+
+	if player.Position() > time.Second {
+		t.Errorf("Expected Song 2 position to start near 0, got %v", player.Position())
+	}
+
+	if source.openCount() != 2 {
+		t.Errorf("Expected 2 streams to be opened, got %d", source.openCount())
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) >= 3
+	})
+	player.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var types []EventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	if len(types) != 3 || types[1] != EventTrackEnded || types[2] != EventTrackStarted || events[2].Track != second {
+		t.Errorf("Expected TrackStarted, TrackEnded, TrackStarted for Song 2, got %v", types)
+	}
+}
+
+func TestPlayerCrossfadeQueueChanged(t *testing.T) {
+	player, sink, source := newTestPlayer(100000)
+	player.SetTransition(Transition{Enabled: true})
+
+	first := &Track{Title: "Song 1", URL: "url1", Duration: 30 * time.Second}
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(first)
+	player.AddToQueue(&Track{Title: "Song 2", URL: "url2", Duration: 30 * time.Second})
+	player.Play()
+
+	playUntil(t, player, sink, 20*time.Second)
+	waitFor(t, func() bool { return hasHandoff(player) })
+
+	// Without Song 2 in the queue the prepared stream is dropped
+	player.ClearQueue()
+	playUntil(t, player, sink, 29*time.Second)
+
+	if player.GetCurrentTrack() != first {
+		t.Errorf("Expected Song 1 to keep playing, got %v", player.GetCurrentTrack())
+	}
+
+	if hasHandoff(player) {
+		t.Error("Expected prepared transition to be dropped")
+	}
+
+	if source.openCount() != 2 {
+		t.Errorf("Expected no stream to be opened after the queue changed, got %d", source.openCount())
+	}
+
+	player.Stop()
+}
+
+func TestTransitionString(t *testing.T) {
+	tests := []struct {
+		transition Transition
+		want       string
+	}{
+		{Transition{}, "off"},
+		{Transition{Enabled: true}, "gapless"},
+		{Transition{Enabled: true, Crossfade: 5 * time.Second}, "crossfade 0:05"},
+	}
+
+	for _, test := range tests {
+		if got := test.transition.String(); got != test.want {
+			t.Errorf("Expected %+v to be %q, got %q", test.transition, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package music
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// VoiceSink receives encoded Opus frames for a joined voice channel.
+type VoiceSink interface {
+	SendOpus(frame []byte) error
+	Speaking(speaking bool) error
+	Disconnect() error
+}
+
+// VoiceConnector joins voice channels on behalf of a Player.
+type VoiceConnector interface {
+	JoinVoice(guildID, channelID string) (VoiceSink, error)
+}
+
+// DiscordConnector joins voice channels through a discordgo session.
+type DiscordConnector struct {
+	Session *discordgo.Session
+}
+
+func NewDiscordConnector(s *discordgo.Session) *DiscordConnector {
+	return &DiscordConnector{Session: s}
+}
+
+func (c *DiscordConnector) JoinVoice(guildID, channelID string) (VoiceSink, error) {
+	vc, err := c.Session.ChannelVoiceJoin(guildID, channelID, false, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join voice channel: %w", err)
+	}
+
+	return &discordSink{vc: vc}, nil
+}
+
+// discordSink adapts a discordgo voice connection to VoiceSink
+type discordSink struct {
+	vc *discordgo.VoiceConnection
+}
+
+// sendTimeout bounds how long a frame may wait for the voice connection
+// before playback gives up, e.g. after Discord dropped the connection.
+const sendTimeout = 5 * time.Second
+
+func (d *discordSink) SendOpus(frame []byte) error {
+	select {
+	case d.vc.OpusSend <- frame:
+		return nil
+	case <-time.After(sendTimeout):
+		return fmt.Errorf("timed out sending audio to voice channel")
+	}
+}
+
+func (d *discordSink) Speaking(speaking bool) error {
+	return d.vc.Speaking(speaking)
+}
+
+func (d *discordSink) Disconnect() error {
+	return d.vc.Disconnect()
+}
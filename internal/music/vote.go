@@ -0,0 +1,57 @@
+package music
+
+import (
+	"fmt"
+	"math"
+)
+
+// VoteSkip records userID's vote to skip the current track and skips it
+// once at least needed users have voted. Votes are cleared whenever a new
+// track starts. It returns the number of votes cast for the current track.
+func (p *Player) VoteSkip(userID string, needed int) (votes int, skipped bool, err error) {
+	defer p.flushEvents()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Current == nil {
+		return 0, false, fmt.Errorf("nothing is playing")
+	}
+
+	if p.skipVotes == nil {
+		p.skipVotes = make(map[string]bool)
+	}
+	p.skipVotes[userID] = true
+	votes = len(p.skipVotes)
+
+	if votes < needed {
+		return votes, false, nil
+	}
+
+	// The queue running out after the skip is not an error for the voter
+	p.skipLocked()
+	return votes, true, nil
+}
+
+// SkipVotes returns the number of votes to skip the current track.
+func (p *Player) SkipVotes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.skipVotes)
+}
+
+// RequiredVotes returns how many of listeners must vote to skip a track
+// when ratio of them is needed. At least one vote is always required.
+func RequiredVotes(listeners int, ratio float64) int {
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	// Allow for float error, e.g. 10 * 0.3 is slightly above 3
+	needed := int(math.Ceil(float64(listeners)*ratio - 1e-9))
+	if needed < 1 {
+		needed = 1
+	}
+
+	return needed
+}
@@ -0,0 +1,65 @@
+package music
+
+import "testing"
+
+func TestPlayerVoteSkip(t *testing.T) {
+	player, sink, _ := newTestPlayer(1000)
+
+	if _, _, err := player.VoteSkip("user1", 2); err == nil {
+		t.Error("Expected error voting with nothing playing, got nil")
+	}
+
+	player.ConnectToVoice("guild", "channel")
+	player.AddToQueue(&Track{Title: "Song 1", URL: "url1"})
+	player.AddToQueue(&Track{Title: "Song 2", URL: "url2"})
+	player.Play()
+	receiveFrame(t, sink)
+
+	votes, skipped, err := player.VoteSkip("user1", 2)
+	if err != nil || votes != 1 || skipped {
+		t.Errorf("Expected 1 vote without skipping, got %d votes, skipped %v, err %v", votes, skipped, err)
+	}
+
+	// Voting twice doesn't count twice
+	votes, skipped, _ = player.VoteSkip("user1", 2)
+	if votes != 1 || skipped {
+		t.Errorf("Expected repeated vote to be ignored, got %d votes, skipped %v", votes, skipped)
+	}
+
+	votes, skipped, _ = player.VoteSkip("user2", 2)
+	if votes != 2 || !skipped {
+		t.Errorf("Expected second vote to skip, got %d votes, skipped %v", votes, skipped)
+	}
+
+	if player.GetCurrentTrack().URL != "url2" {
+		t.Errorf("Expected Song 2 to be playing, got %s", player.GetCurrentTrack().Title)
+	}
+
+	if player.SkipVotes() != 0 {
+		t.Errorf("Expected votes to reset for the next track, got %d", player.SkipVotes())
+	}
+
+	player.Stop()
+}
+
+func TestRequiredVotes(t *testing.T) {
+	tests := []struct {
+		listeners int
+		ratio     float64
+		want      int
+	}{
+		{1, 0.5, 1},
+		{2, 0.5, 1},
+		{3, 0.5, 2},
+		{10, 0.3, 3},
+		{4, 1, 4},
+		{0, 0.5, 1},
+		{4, 0, 4}, // Invalid ratios require everyone
+	}
+
+	for _, test := range tests {
+		if got := RequiredVotes(test.listeners, test.ratio); got != test.want {
+			t.Errorf("Expected RequiredVotes(%d, %v) to be %d, got %d", test.listeners, test.ratio, test.want, got)
+		}
+	}
+}
@@ -167,16 +167,16 @@ var AvailableTools = []Tool{
 		Type: "function",
 		Function: Function{
 			Name:        "play_music",
-			Description: "Play music from a given URL",
+			Description: "Play music from a given URL or by searching for a song",
 			Parameters: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"url": map[string]interface{}{
+					"query": map[string]interface{}{
 						"type":        "string",
-						"description": "The URL of the music to play",
+						"description": "The URL of the music to play, or search terms such as the song title and artist",
 					},
 				},
-				"required": []string{"url"},
+				"required": []string{"query"},
 			},
 		},
 	},
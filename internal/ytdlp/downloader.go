@@ -1,10 +1,19 @@
 package ytdlp
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/url"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Downloader struct {
@@ -16,16 +25,85 @@ type DownloadOptions struct {
 	Format   string
 	Audio    bool
 	NoCookie bool
+
+	// OutputDir is where the file is written, created if needed. When
+	// empty, every download gets a fresh temporary directory of its own.
+	OutputDir string
+
+	// Progress, if set, is called as the download moves along. It runs
+	// while yt-dlp's output is being read, so it shouldn't block.
+	Progress func(Progress)
 }
 
 type VideoInfo struct {
-	Title       string `json:"title"`
-	Duration    int    `json:"duration"`
-	Uploader    string `json:"uploader"`
-	ViewCount   int    `json:"view_count"`
-	LikeCount   int    `json:"like_count"`
-	Description string `json:"description"`
-	Thumbnail   string `json:"thumbnail"`
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Duration    float64 `json:"duration"` // Seconds, fractional for many sites
+	Uploader    string  `json:"uploader"`
+	ViewCount   int     `json:"view_count"`
+	LikeCount   int     `json:"like_count"`
+	Description string  `json:"description"`
+	Thumbnail   string  `json:"thumbnail"`
+	WebpageURL  string  `json:"webpage_url"`
+	StreamURL   string  `json:"url"` // Direct URL of the selected audio format
+
+	Subtitles         map[string][]Subtitle `json:"subtitles"`          // Language -> formats
+	AutomaticCaptions map[string][]Subtitle `json:"automatic_captions"` // Language -> formats
+}
+
+// Subtitle is one format a subtitle track is available in.
+type Subtitle struct {
+	Ext  string `json:"ext"`
+	URL  string `json:"url"`
+	Name string `json:"name"`
+}
+
+// SubtitleURL returns the URL of a subtitle track in the given format
+// (e.g. "vtt") for the first of langs that has one. Uploaded subtitles
+// are preferred over automatic captions. Languages match by prefix, so
+// "en" also finds "en-US". It returns "" if there is none.
+func (info *VideoInfo) SubtitleURL(langs []string, ext string) string {
+	for _, tracks := range []map[string][]Subtitle{info.Subtitles, info.AutomaticCaptions} {
+		for _, lang := range langs {
+			if found := findSubtitle(tracks, lang, ext); found != "" {
+				return found
+			}
+		}
+	}
+
+	return ""
+}
+
+func findSubtitle(tracks map[string][]Subtitle, lang, ext string) string {
+	// Exact matches first, so "en" doesn't pick "en-GB" over "en"
+	names := []string{lang}
+	for name := range tracks {
+		if name != lang && strings.HasPrefix(name, lang+"-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+
+	for _, name := range names {
+		for _, format := range tracks[name] {
+			if format.Ext == ext && format.URL != "" {
+				return format.URL
+			}
+		}
+	}
+
+	return ""
+}
+
+// Entry is a single result from a yt-dlp search or flat playlist listing.
+// Only basic metadata is available; use GetInfo on URL for the rest.
+type Entry struct {
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	URL      string  `json:"url"`
+	Duration float64 `json:"duration"`
+	Uploader string  `json:"uploader"`
+	Channel  string  `json:"channel"`
 }
 
 func NewDownloader() *Downloader {
@@ -34,8 +112,25 @@ func NewDownloader() *Downloader {
 	}
 }
 
-func (d *Downloader) DownloadVideo(opts DownloadOptions) (string, error) {
-	args := []string{"--no-check-certificate"}
+// SetMaxConcurrent sets how many downloads a Queue created from the
+// downloader runs at once.
+func (d *Downloader) SetMaxConcurrent(n int) {
+	if n > 0 {
+		d.maxConcurrent = n
+	}
+}
+
+// DownloadVideo downloads a single video, or its audio, and describes the
+// finished file. Call Remove on the result once the file isn't needed.
+func (d *Downloader) DownloadVideo(opts DownloadOptions) (*DownloadResult, error) {
+	return d.DownloadVideoContext(context.Background(), opts)
+}
+
+// DownloadVideoContext downloads like DownloadVideo, but gives up when ctx
+// is done: yt-dlp and whatever it started are killed and the partly
+// downloaded files removed.
+func (d *Downloader) DownloadVideoContext(ctx context.Context, opts DownloadOptions) (*DownloadResult, error) {
+	args := []string{"--no-check-certificate", "--newline", "--no-playlist"}
 
 	if opts.NoCookie {
 		args = append(args, "--no-cookies")
@@ -47,45 +142,132 @@ func (d *Downloader) DownloadVideo(opts DownloadOptions) (string, error) {
 		args = append(args, "-f", opts.Format)
 	}
 
-	// Output to temporary file
-	args = append(args, "-o", "/tmp/%(title)s.%(ext)s", opts.URL)
+	// Each download writes to its own directory, so names never clash and
+	// everything it leaves behind can be found
+	dir := opts.OutputDir
+	jobDir := ""
+	if dir == "" {
+		var err error
+		if dir, err = os.MkdirTemp("", "ytdlp-"); err != nil {
+			return nil, fmt.Errorf("failed to create download directory: %v", err)
+		}
+		jobDir = dir
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %v", err)
+	}
 
-	cmd := exec.Command("yt-dlp", args...)
-	output, err := cmd.CombinedOutput()
+	// yt-dlp prints the info of the finished file, including where it
+	// ended up after merging and converting, once it is in place
+	results, err := os.CreateTemp("", "ytdlp-result-*.json")
 	if err != nil {
-		return "", fmt.Errorf("download failed: %v, output: %s", err, string(output))
-	}
-
-	// Extract filename from output
-	lines := strings.Split(string(output), "\n")
-	for i := len(lines) - 1; i >= 0; i-- {
-		if strings.Contains(lines[i], "[Merger] Merging formats into") {
-			// Extract filename from merger line
-			parts := strings.Split(lines[i], " ")
-			if len(parts) > 5 {
-				filename := strings.Trim(parts[5], "\"")
-				return filename, nil
-			}
+		os.RemoveAll(jobDir)
+		return nil, fmt.Errorf("failed to create result file: %v", err)
+	}
+	results.Close()
+	defer os.Remove(results.Name())
+
+	args = append(args,
+		"-o", filepath.Join(dir, "%(title)s.%(ext)s"),
+		"--print-to-file", "after_move:%()j", results.Name(),
+		opts.URL,
+	)
+
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	// yt-dlp runs ffmpeg for merging and converting, which has to go too
+	killProcessGroup(cmd)
+	cmd.WaitDelay = 5 * time.Second
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	var lines []string
+	// Whatever a failed download left behind is of no use
+	cleanup := func() {
+		if jobDir != "" {
+			os.RemoveAll(jobDir)
+		} else {
+			removePartialFiles(lines)
 		}
-		
-		// Also check for destination line
-		if strings.Contains(lines[i], "[download] Destination:") {
-			parts := strings.Split(lines[i], " ")
-			if len(parts) > 3 {
-				filename := strings.TrimSpace(parts[3])
-				return filename, nil
-			}
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to create yt-dlp pipe: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to start yt-dlp: %v", err)
+	}
+
+	// Report progress as it comes in rather than when yt-dlp exits
+	lines, _ = readOutput(stdout, opts.Progress)
+	io.Copy(io.Discard, stdout)
+
+	if err := cmd.Wait(); err != nil {
+		cleanup()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
+		return nil, fmt.Errorf("download failed: %v, output: %s", err, stderr.String())
+	}
+
+	result, err := readResult(results.Name())
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	result.dir = jobDir
+
+	if opts.Progress != nil {
+		opts.Progress(Progress{Stage: StageDone})
 	}
 
-	return "", fmt.Errorf("could not determine output filename")
+	return result, nil
+}
+
+// removePartialFiles deletes what a stopped download left behind: the
+// files yt-dlp said it was writing, their .part and .ytdl companions and
+// any fragments
+func removePartialFiles(lines []string) {
+	for _, line := range lines {
+		var filename string
+		switch {
+		case strings.HasPrefix(line, "[download] Destination: "):
+			filename = strings.TrimPrefix(line, "[download] Destination: ")
+		case strings.HasPrefix(line, "[Merger] Merging formats into "):
+			filename = strings.Trim(strings.TrimPrefix(line, "[Merger] Merging formats into "), "\"")
+		default:
+			continue
+		}
+
+		for _, name := range []string{filename, filename + ".part", filename + ".ytdl", filename + ".temp"} {
+			os.Remove(name)
+		}
+		fragments, _ := filepath.Glob(filename + ".part-Frag*")
+		for _, fragment := range fragments {
+			os.Remove(fragment)
+		}
+	}
 }
 
+// GetInfo fetches metadata for a single video. The best audio-only format
+// is selected so StreamURL can be handed straight to ffmpeg.
 func (d *Downloader) GetInfo(url string) (*VideoInfo, error) {
-	cmd := exec.Command("yt-dlp", "--dump-json", url)
-	output, err := cmd.CombinedOutput()
+	cmd := exec.Command("yt-dlp", "--dump-json", "--no-playlist", "-f", "bestaudio/best", url)
+	output, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get video info: %v, output: %s", err, string(output))
+		return nil, fmt.Errorf("failed to get video info: %v, output: %s", err, commandStderr(err))
+	}
+
+	return parseVideoInfo(output)
+}
+
+func parseVideoInfo(output []byte) (*VideoInfo, error) {
+	// A search with no hits exits cleanly without printing anything
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return nil, fmt.Errorf("no results found")
 	}
 
 	var info VideoInfo
@@ -96,6 +278,131 @@ func (d *Downloader) GetInfo(url string) (*VideoInfo, error) {
 	return &info, nil
 }
 
+// Search returns the top YouTube results for query.
+func (d *Downloader) Search(query string, limit int) ([]Entry, error) {
+	if limit < 1 {
+		limit = 1
+	}
+
+	target := fmt.Sprintf("ytsearch%d:%s", limit, query)
+	cmd := exec.Command("yt-dlp", "--flat-playlist", "--dump-json", "--no-warnings", target)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %v, output: %s", err, commandStderr(err))
+	}
+
+	return parseEntries(output)
+}
+
+// GetPlaylist lists up to limit entries of a playlist without resolving
+// each one. A limit of 0 lists the whole playlist.
+func (d *Downloader) GetPlaylist(url string, limit int) ([]Entry, error) {
+	args := []string{"--flat-playlist", "--dump-json", "--no-warnings"}
+	if limit > 0 {
+		args = append(args, "--playlist-end", strconv.Itoa(limit))
+	}
+	args = append(args, url)
+
+	cmd := exec.Command("yt-dlp", args...)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playlist: %v, output: %s", err, commandStderr(err))
+	}
+
+	return parseEntries(output)
+}
+
+// GetMix lists up to limit tracks from YouTube's automatic mix for a
+// video, which starts with the video itself.
+func (d *Downloader) GetMix(videoID string, limit int) ([]Entry, error) {
+	if videoID == "" {
+		return nil, fmt.Errorf("no video ID to build a mix from")
+	}
+
+	return d.GetPlaylist(MixURL(videoID), limit)
+}
+
+// MixURL returns the URL of YouTube's automatic mix playlist for a video
+func MixURL(videoID string) string {
+	return fmt.Sprintf("https://www.youtube.com/watch?v=%s&list=RD%s", url.QueryEscape(videoID), url.QueryEscape(videoID))
+}
+
+// IsYouTubeURL reports whether rawURL points at YouTube or YouTube Music.
+func IsYouTubeURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+
+	switch host {
+	case "youtube.com", "music.youtube.com", "youtu.be":
+		return true
+	}
+
+	return false
+}
+
+// IsPlaylistURL reports whether rawURL points at a YouTube or SoundCloud
+// playlist rather than a single track. Videos opened from a playlist
+// (watch?v=...&list=...) count as single tracks.
+func IsPlaylistURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+
+	switch host {
+	case "youtube.com", "music.youtube.com":
+		return parsed.Path == "/playlist" && parsed.Query().Get("list") != ""
+	case "soundcloud.com":
+		return strings.Contains(parsed.Path, "/sets/")
+	}
+
+	return false
+}
+
+// parseEntries reads the one-JSON-object-per-line output of --flat-playlist
+func parseEntries(output []byte) ([]Entry, error) {
+	var entries []Entry
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse entry: %v", err)
+		}
+
+		// Flat YouTube entries sometimes only carry the video ID
+		if entry.URL == "" && entry.ID != "" {
+			entry.URL = "https://www.youtube.com/watch?v=" + entry.ID
+		}
+		if entry.Uploader == "" {
+			entry.Uploader = entry.Channel
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// commandStderr returns what a failed command wrote to stderr
+func commandStderr(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(exitErr.Stderr)
+	}
+	return ""
+}
+
 func (d *Downloader) GetFormats(url string) (string, error) {
 	cmd := exec.Command("yt-dlp", "-F", url)
 	output, err := cmd.CombinedOutput()
@@ -106,7 +413,7 @@ func (d *Downloader) GetFormats(url string) (string, error) {
 	return string(output), nil
 }
 
-func (d *Downloader) DownloadWithFormat(url, format string) (string, error) {
+func (d *Downloader) DownloadWithFormat(url, format string) (*DownloadResult, error) {
 	opts := DownloadOptions{
 		URL:    url,
 		Format: format,
@@ -115,7 +422,7 @@ func (d *Downloader) DownloadWithFormat(url, format string) (string, error) {
 	return d.DownloadVideo(opts)
 }
 
-func (d *Downloader) DownloadAudio(url string) (string, error) {
+func (d *Downloader) DownloadAudio(url string) (*DownloadResult, error) {
 	opts := DownloadOptions{
 		URL:   url,
 		Audio: true,
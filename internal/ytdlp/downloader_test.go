@@ -1,7 +1,12 @@
 package ytdlp
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestNewDownloader(t *testing.T) {
@@ -53,7 +58,7 @@ func TestVideoInfoStruct(t *testing.T) {
 	}
 
 	if info.Duration != 300 {
-		t.Errorf("Expected Duration to be 300, got %d", info.Duration)
+		t.Errorf("Expected Duration to be 300, got %f", info.Duration)
 	}
 
 	if info.Uploader != "Test User" {
@@ -75,4 +80,318 @@ func TestVideoInfoStruct(t *testing.T) {
 	if info.Thumbnail != "https://example.com/thumbnail.jpg" {
 		t.Errorf("Expected Thumbnail to be 'https://example.com/thumbnail.jpg', got '%s'", info.Thumbnail)
 	}
-}
\ No newline at end of file
+}
+
+func TestParseVideoInfo(t *testing.T) {
+	output := []byte(`{
+		"id": "dQw4w9WgXcQ",
+		"title": "Test Video",
+		"duration": 212,
+		"uploader": "Test User",
+		"thumbnail": "https://example.com/thumbnail.jpg",
+		"webpage_url": "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		"url": "https://rr1.example.com/videoplayback?itag=251",
+		"format_id": "251"
+	}`)
+
+	info, err := parseVideoInfo(output)
+	if err != nil {
+		t.Fatalf("Failed to parse video info: %v", err)
+	}
+
+	if info.ID != "dQw4w9WgXcQ" {
+		t.Errorf("Expected ID to be 'dQw4w9WgXcQ', got '%s'", info.ID)
+	}
+
+	if info.Duration != 212 {
+		t.Errorf("Expected Duration to be 212, got %f", info.Duration)
+	}
+
+	if info.WebpageURL != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Errorf("Expected WebpageURL to be 'https://www.youtube.com/watch?v=dQw4w9WgXcQ', got '%s'", info.WebpageURL)
+	}
+
+	if info.StreamURL != "https://rr1.example.com/videoplayback?itag=251" {
+		t.Errorf("Expected StreamURL to be 'https://rr1.example.com/videoplayback?itag=251', got '%s'", info.StreamURL)
+	}
+
+	if _, err := parseVideoInfo([]byte("WARNING: not json")); err == nil {
+		t.Error("Expected error parsing invalid output, got nil")
+	}
+
+	// SoundCloud, Bandcamp and direct files report fractional seconds
+	info, err = parseVideoInfo([]byte(`{"id": "123", "title": "Track", "duration": 213.4}`))
+	if err != nil {
+		t.Fatalf("Failed to parse fractional duration: %v", err)
+	}
+	if info.Duration != 213.4 {
+		t.Errorf("Expected Duration to be 213.4, got %f", info.Duration)
+	}
+}
+
+func TestSubtitleURL(t *testing.T) {
+	output := []byte(`{
+		"id": "abc",
+		"subtitles": {
+			"de": [{"ext": "vtt", "url": "https://example.com/de.vtt"}],
+			"en-US": [{"ext": "json3", "url": "https://example.com/en-US.json3"}, {"ext": "vtt", "url": "https://example.com/en-US.vtt"}]
+		},
+		"automatic_captions": {
+			"en": [{"ext": "vtt", "url": "https://example.com/auto-en.vtt"}],
+			"id": [{"ext": "vtt", "url": "https://example.com/auto-id.vtt"}]
+		}
+	}`)
+
+	info, err := parseVideoInfo(output)
+	if err != nil {
+		t.Fatalf("Failed to parse video info: %v", err)
+	}
+
+	// Uploaded subtitles win over automatic captions, matching by prefix
+	if got := info.SubtitleURL([]string{"en"}, "vtt"); got != "https://example.com/en-US.vtt" {
+		t.Errorf("Expected uploaded en-US subtitles, got '%s'", got)
+	}
+
+	if got := info.SubtitleURL([]string{"id", "en"}, "vtt"); got != "https://example.com/en-US.vtt" {
+		t.Errorf("Expected uploaded subtitles in a later language over captions, got '%s'", got)
+	}
+
+	if got := info.SubtitleURL([]string{"id"}, "vtt"); got != "https://example.com/auto-id.vtt" {
+		t.Errorf("Expected automatic captions, got '%s'", got)
+	}
+
+	if got := info.SubtitleURL([]string{"fr"}, "vtt"); got != "" {
+		t.Errorf("Expected no subtitles for a missing language, got '%s'", got)
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	output := []byte(`{"_type": "url", "id": "abc123", "title": "First Song", "url": "https://www.youtube.com/watch?v=abc123", "duration": 212.0, "channel": "Artist One", "uploader": null}
+{"_type": "url", "id": "def456", "title": "Second Song", "duration": 95.5, "uploader": "Artist Two"}
+
+`)
+
+	entries, err := parseEntries(output)
+	if err != nil {
+		t.Fatalf("Failed to parse entries: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+
+	if entries[0].Title != "First Song" {
+		t.Errorf("Expected Title to be 'First Song', got '%s'", entries[0].Title)
+	}
+
+	if entries[0].Duration != 212 {
+		t.Errorf("Expected Duration to be 212, got %f", entries[0].Duration)
+	}
+
+	if entries[0].Uploader != "Artist One" {
+		t.Errorf("Expected Uploader to fall back to channel 'Artist One', got '%s'", entries[0].Uploader)
+	}
+
+	if entries[1].URL != "https://www.youtube.com/watch?v=def456" {
+		t.Errorf("Expected URL to be built from ID, got '%s'", entries[1].URL)
+	}
+
+	if _, err := parseEntries([]byte("not json\n")); err == nil {
+		t.Error("Expected error parsing invalid output, got nil")
+	}
+}
+
+func TestIsPlaylistURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://www.youtube.com/playlist?list=PL123":       true,
+		"https://music.youtube.com/playlist?list=OLAK5uy":   true,
+		"https://soundcloud.com/artist/sets/best-of":        true,
+		"https://www.youtube.com/watch?v=abc123&list=PL123": false,
+		"https://www.youtube.com/watch?v=abc123":            false,
+		"https://soundcloud.com/artist/song":                false,
+		"https://example.com/playlist?list=PL123":           false,
+		"not a url": false,
+	}
+
+	for input, want := range tests {
+		if got := IsPlaylistURL(input); got != want {
+			t.Errorf("Expected IsPlaylistURL('%s') to be %v, got %v", input, want, got)
+		}
+	}
+}
+
+func TestMixURL(t *testing.T) {
+	if got := MixURL("dQw4w9WgXcQ"); got != "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=RDdQw4w9WgXcQ" {
+		t.Errorf("Unexpected mix URL: %s", got)
+	}
+}
+
+func TestIsYouTubeURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://www.youtube.com/watch?v=abc":   true,
+		"https://youtu.be/abc":                  true,
+		"https://music.youtube.com/watch?v=abc": true,
+		"https://soundcloud.com/artist/track":   false,
+		"https://example.com/youtube.com/watch": false,
+		"not a url":                             false,
+	}
+
+	for rawURL, want := range tests {
+		if got := IsYouTubeURL(rawURL); got != want {
+			t.Errorf("Expected IsYouTubeURL(%q) to be %v, got %v", rawURL, want, got)
+		}
+	}
+}
+
+// fakeYtDlp puts a yt-dlp on PATH that runs script. Before it runs, $dir
+// holds the directory of the -o template, $result the file given to
+// --print-to-file, $flat is 1 for --flat-playlist and $url is the URL.
+func fakeYtDlp(t *testing.T, script string) {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("fake yt-dlp is a shell script")
+	}
+
+	script = "#!/bin/sh\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"  case \"$1\" in\n" +
+		"    -o) dir=$(dirname \"$2\"); shift 2 ;;\n" +
+		"    --print-to-file) result=$3; shift 3 ;;\n" +
+		"    --flat-playlist) flat=1; shift ;;\n" +
+		"    -*) shift ;;\n" +
+		"    *) url=$1; shift ;;\n" +
+		"  esac\n" +
+		"done\n" + script
+
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "yt-dlp"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestDownloadVideoResult(t *testing.T) {
+	fakeYtDlp(t, `
+echo "[download] Destination: $dir/Song.f251.webm"
+printf 'audio' > "$dir/Song.mp3"
+echo '{"id": "abc", "title": "Song", "duration": 61.5, "format_id": "251", "filepath": "'"$dir/Song.mp3"'"}' >> "$result"
+`)
+
+	result, err := NewDownloader().DownloadVideo(DownloadOptions{URL: "https://example.com/song", Audio: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if filepath.Base(result.Path) != "Song.mp3" || result.Size != 5 || result.Format != "251" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if result.Duration != 61500*time.Millisecond || result.Info.Duration != 61.5 || result.Info.Title != "Song" {
+		t.Errorf("Unexpected duration or info: %v, %+v", result.Duration, result.Info)
+	}
+
+	// The file gets a directory of its own, which goes with it
+	dir := filepath.Dir(result.Path)
+	if err := result.Remove(); err != nil {
+		t.Fatalf("Failed to remove download: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected the job directory to be removed, got %v", err)
+	}
+}
+
+func TestDownloadVideoNoResult(t *testing.T) {
+	dir := t.TempDir()
+	fakeYtDlp(t, `touch "$dir/video.mp4"`)
+
+	if _, err := NewDownloader().DownloadVideo(DownloadOptions{URL: "https://example.com/video", OutputDir: dir}); err == nil {
+		t.Error("Expected an error when yt-dlp reports no file")
+	}
+}
+
+func TestDownloadVideoContextCancel(t *testing.T) {
+	dir := t.TempDir()
+	// The child stands in for ffmpeg, which yt-dlp runs to merge formats
+	fakeYtDlp(t, `
+echo "[download] Destination: $dir/video.mp4"
+touch "$dir/video.mp4.part"
+sleep 30 &
+echo "[download]   1.0% of 10.00MiB at 1.00MiB/s ETA 00:09"
+wait
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	opts := DownloadOptions{
+		URL:       "https://example.com/video",
+		OutputDir: dir,
+		Progress: func(progress Progress) {
+			if progress.Percent > 0 {
+				close(started)
+			}
+		},
+	}
+	result := make(chan error, 1)
+	go func() {
+		_, err := NewDownloader().DownloadVideoContext(ctx, opts)
+		result <- err
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the download to start")
+	}
+	cancel()
+
+	// The child holds yt-dlp's output open, so this only returns quickly
+	// if it was killed along with yt-dlp
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the download to stop")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "video.mp4.part")); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial file to be removed, got %v", err)
+	}
+}
+
+func TestImportSoundCloudSet(t *testing.T) {
+	// SoundCloud reports durations in fractional seconds, in the listing
+	// and for each track
+	fakeYtDlp(t, `
+if [ "$flat" = 1 ]; then
+  echo '{"id": "111", "title": "First", "url": "https://soundcloud.com/artist/first", "duration": 183.672}'
+  echo '{"id": "222", "title": "Second", "url": "https://soundcloud.com/artist/second", "duration": 241.05}'
+  exit 0
+fi
+case "$url" in
+  */first) echo '{"id": "111", "title": "First", "duration": 183.672, "webpage_url": "'"$url"'", "url": "https://cf-media.sndcdn.com/first.mp3"}' ;;
+  */second) echo '{"id": "222", "title": "Second", "duration": 241.05, "webpage_url": "'"$url"'", "url": "https://cf-media.sndcdn.com/second.mp3"}' ;;
+  *) exit 1 ;;
+esac
+`)
+
+	downloader := NewDownloader()
+	entries, err := downloader.GetPlaylist("https://soundcloud.com/artist/sets/album", 0)
+	if err != nil {
+		t.Fatalf("Failed to list the set: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Duration != 183.672 {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+
+	for _, entry := range entries {
+		info, err := downloader.GetInfo(entry.URL)
+		if err != nil {
+			t.Fatalf("Failed to look up %s: %v", entry.URL, err)
+		}
+		if info.Title != entry.Title || info.Duration != entry.Duration || info.StreamURL == "" {
+			t.Errorf("Unexpected info for %s: %+v", entry.URL, info)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package ytdlp
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// killProcessGroup makes cancelling cmd's context kill the whole process
+// tree, not just cmd itself.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	}
+}
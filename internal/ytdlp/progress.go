@@ -0,0 +1,211 @@
+package ytdlp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stage is what a download is busy with.
+type Stage int
+
+const (
+	StageStarting    Stage = iota // Looking up the video
+	StageDownloading              // Fetching a format, see Progress.Percent
+	StageMerging                  // Muxing video and audio into one file
+	StageConverting               // Post-processing, e.g. extracting audio
+	StageDone
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageStarting:
+		return "starting"
+	case StageDownloading:
+		return "downloading"
+	case StageMerging:
+		return "merging"
+	case StageConverting:
+		return "converting"
+	case StageDone:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
+// Progress is a download's state as reported by yt-dlp.
+type Progress struct {
+	Stage   Stage
+	Part    int           // Which file is downloading, counting from 1; video and audio are fetched separately
+	Percent float64       // 0 - 100 of the current part
+	Total   int64         // Size of the current part in bytes, 0 if unknown
+	Speed   int64         // Bytes per second, 0 if unknown
+	ETA     time.Duration // Time left for the current part, 0 if unknown
+}
+
+func (p Progress) String() string {
+	if p.Stage != StageDownloading {
+		return p.Stage.String()
+	}
+
+	text := fmt.Sprintf("%.1f%%", p.Percent)
+	if p.Total > 0 {
+		text += " of " + FormatBytes(p.Total)
+	}
+	if p.Speed > 0 {
+		text += " at " + FormatBytes(p.Speed) + "/s"
+	}
+	if p.ETA > 0 {
+		text += fmt.Sprintf(", %s left", p.ETA)
+	}
+	return text
+}
+
+var (
+	// [download]  42.5% of ~  10.20MiB at    1.50MiB/s ETA 00:04 (frag 3/20)
+	progressLine = regexp.MustCompile(`^\[download\]\s+([0-9.]+)%(?:\s+of\s+~?\s*([0-9.]+\s*[KMGTP]?i?B))?(?:\s+at\s+([0-9.]+\s*[KMGTP]?i?B)/s)?(?:\s+ETA\s+([0-9:]+))?`)
+	byteSize     = regexp.MustCompile(`^([0-9.]+)\s*([KMGTP]?)(i?)B$`)
+)
+
+// ParseProgress reads one line of yt-dlp output, updating the progress
+// so far. It reports false for lines that say nothing about progress.
+func ParseProgress(line string, progress Progress) (Progress, bool) {
+	line = strings.TrimSpace(line)
+
+	switch {
+	case strings.HasPrefix(line, "[download] Destination:"),
+		strings.HasPrefix(line, "[download]") && strings.HasSuffix(line, "has already been downloaded"):
+		progress.Stage = StageDownloading
+		progress.Part++
+		progress.Percent, progress.Total, progress.Speed, progress.ETA = 0, 0, 0, 0
+		return progress, true
+	case strings.HasPrefix(line, "[Merger]"):
+		progress.Stage = StageMerging
+		return progress, true
+	case strings.HasPrefix(line, "[ExtractAudio]"), strings.HasPrefix(line, "[VideoConvertor]"),
+		strings.HasPrefix(line, "[VideoRemuxer]"), strings.HasPrefix(line, "[FixupM3u8]"):
+		progress.Stage = StageConverting
+		return progress, true
+	}
+
+	match := progressLine.FindStringSubmatch(line)
+	if match == nil {
+		return progress, false
+	}
+
+	progress.Stage = StageDownloading
+	if progress.Part == 0 {
+		progress.Part = 1
+	}
+	progress.Percent, _ = strconv.ParseFloat(match[1], 64)
+	if total := parseBytes(match[2]); total > 0 {
+		progress.Total = total
+	}
+	progress.Speed = parseBytes(match[3])
+	progress.ETA = parseClock(match[4])
+
+	return progress, true
+}
+
+// parseBytes reads sizes like "10.20MiB" or "512KiB", 0 if unknown
+func parseBytes(s string) int64 {
+	match := byteSize.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return 0
+	}
+
+	value, _ := strconv.ParseFloat(match[1], 64)
+
+	base := 1000.0
+	if match[3] == "i" {
+		base = 1024
+	}
+	if match[2] != "" {
+		value *= math.Pow(base, float64(strings.Index("KMGTP", match[2])+1))
+	}
+
+	return int64(value)
+}
+
+// parseClock reads an ETA like "01:02:03" or "00:04"
+func parseClock(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+
+	var seconds int
+	for _, part := range strings.Split(s, ":") {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + value
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// FormatBytes renders a size the way people read it, e.g. "10.2 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	value := float64(n)
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	i := -1
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+// readOutput reads yt-dlp's output line by line, calling report whenever
+// the progress changes. It returns the lines read.
+func readOutput(r io.Reader, report func(Progress)) ([]string, error) {
+	var lines []string
+	progress := Progress{Stage: StageStarting}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Split(splitProgressLines)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+
+		updated, ok := ParseProgress(line, progress)
+		if !ok || updated == progress {
+			continue
+		}
+		progress = updated
+		if report != nil {
+			report(progress)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// splitProgressLines is a bufio.SplitFunc that ends lines at either \n or
+// \r, since yt-dlp redraws its progress line with carriage returns.
+func splitProgressLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
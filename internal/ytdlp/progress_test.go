@@ -0,0 +1,102 @@
+package ytdlp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordedOutput is what yt-dlp --newline prints for a video downloaded
+// as separate video and audio formats, with a redrawn line at the end
+const recordedOutput = `[youtube] Extracting URL: https://www.youtube.com/watch?v=dQw4w9WgXcQ
+[youtube] dQw4w9WgXcQ: Downloading webpage
+[info] dQw4w9WgXcQ: Downloading 1 format(s): 137+251
+[download] Destination: /tmp/Rick Astley - Never Gonna Give You Up.f137.mp4
+[download]   0.0% of   80.00MiB at  Unknown B/s ETA Unknown
+[download]  25.0% of   80.00MiB at    2.00MiB/s ETA 00:30
+[download]  25.0% of   80.00MiB at    2.00MiB/s ETA 00:30
+[download] 100% of   80.00MiB in 00:00:40 at 2.00MiB/s
+[download] Destination: /tmp/Rick Astley - Never Gonna Give You Up.f251.webm
+[download]  50.0% of ~   3.50MiB at  512.00KiB/s ETA 01:02:03 (frag 5/10)
+[Merger] Merging formats into "/tmp/Rick Astley - Never Gonna Give You Up.mp4"
+Deleting original file /tmp/Rick Astley - Never Gonna Give You Up.f137.mp4 (pass -k to keep)
+[download]  10.0% of 1.00GiB at 1.00MB/s ETA 00:10` + "\r[download]  20.0% of 1.00GiB at 1.00MB/s ETA 00:09\r"
+
+func TestReadOutput(t *testing.T) {
+	var reported []Progress
+	lines, err := readOutput(strings.NewReader(recordedOutput), func(progress Progress) {
+		reported = append(reported, progress)
+	})
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	if len(lines) != 14 {
+		t.Errorf("Expected 14 lines, got %d", len(lines))
+	}
+
+	const mib = 1024 * 1024
+	expected := []Progress{
+		{Stage: StageDownloading, Part: 1},
+		{Stage: StageDownloading, Part: 1, Percent: 0, Total: 80 * mib},
+		{Stage: StageDownloading, Part: 1, Percent: 25, Total: 80 * mib, Speed: 2 * mib, ETA: 30 * time.Second},
+		{Stage: StageDownloading, Part: 1, Percent: 100, Total: 80 * mib},
+		{Stage: StageDownloading, Part: 2},
+		{Stage: StageDownloading, Part: 2, Percent: 50, Total: 3.5 * mib, Speed: 512 * 1024, ETA: time.Hour + 2*time.Minute + 3*time.Second},
+		{Stage: StageMerging, Part: 2, Percent: 50, Total: 3.5 * mib, Speed: 512 * 1024, ETA: time.Hour + 2*time.Minute + 3*time.Second},
+		{Stage: StageDownloading, Part: 2, Percent: 10, Total: 1024 * mib, Speed: 1000000, ETA: 10 * time.Second},
+		{Stage: StageDownloading, Part: 2, Percent: 20, Total: 1024 * mib, Speed: 1000000, ETA: 9 * time.Second},
+	}
+
+	// Repeated lines don't report anything new
+	if len(reported) != len(expected) {
+		t.Fatalf("Expected %d progress reports, got %d: %+v", len(expected), len(reported), reported)
+	}
+	for i, want := range expected {
+		if reported[i] != want {
+			t.Errorf("Report %d: expected %+v, got %+v", i, want, reported[i])
+		}
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	progress, ok := ParseProgress("[ExtractAudio] Destination: /tmp/song.mp3", Progress{Stage: StageDownloading, Part: 1, Percent: 100})
+	if !ok || progress.Stage != StageConverting {
+		t.Errorf("Expected converting stage, got %+v", progress)
+	}
+
+	progress, ok = ParseProgress("[download] /tmp/song.mp3 has already been downloaded", Progress{})
+	if !ok || progress.Stage != StageDownloading || progress.Part != 1 {
+		t.Errorf("Expected an already downloaded part, got %+v", progress)
+	}
+
+	if _, ok := ParseProgress("[youtube] abc: Downloading webpage", Progress{}); ok {
+		t.Error("Expected a line without progress to be ignored")
+	}
+}
+
+func TestProgressString(t *testing.T) {
+	progress := Progress{Stage: StageDownloading, Percent: 42.5, Total: 10 * 1024 * 1024, Speed: 1536 * 1024, ETA: 4 * time.Second}
+	if text := progress.String(); text != "42.5% of 10.0 MiB at 1.5 MiB/s, 4s left" {
+		t.Errorf("Unexpected progress text: %s", text)
+	}
+
+	if text := (Progress{Stage: StageMerging}).String(); text != "merging" {
+		t.Errorf("Expected 'merging', got %s", text)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		512:                    "512 B",
+		1536:                   "1.5 KiB",
+		25 * 1024 * 1024:       "25.0 MiB",
+		3 * 1024 * 1024 * 1024: "3.0 GiB",
+	}
+
+	for n, expected := range tests {
+		if text := FormatBytes(n); text != expected {
+			t.Errorf("FormatBytes(%d) = %s, expected %s", n, text, expected)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrQueueClosed is reported for jobs that were still waiting when the
+	// queue was closed.
+	ErrQueueClosed = errors.New("download queue is closed")
+
+	// ErrCancelled is reported for jobs stopped with Queue.Cancel.
+	ErrCancelled = errors.New("download was cancelled")
+)
+
+// Job is a download waiting for or running on one of a Queue's workers.
+type Job struct {
+	ID      int    // Assigned by Submit, unique for the queue's lifetime
+	Owner   string // User ID of whoever asked for the download, "" for no per-user limit
+	GuildID string // Server the download was asked for in, "" for none
+	Options DownloadOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Started is called when a worker picks the job up, Done once it has
+	// finished. Both run on the worker and may be nil. The job counts as
+	// running until Done returns, so Done can go on working on the result,
+	// watching Context to stop if the job is cancelled.
+	Started func()
+	Done    func(result *DownloadResult, err error)
+}
+
+// Context is cancelled when the job is cancelled or has finished.
+func (j *Job) Context() context.Context {
+	return j.ctx
+}
+
+// Queue runs downloads on a fixed number of workers, so only so many
+// yt-dlp processes run at once. Jobs wait their turn in order.
+type Queue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	pending  []*Job
+	running  []*Job
+	workers  int
+	perUser  int
+	closed   bool
+	nextID   int
+	download func(ctx context.Context, opts DownloadOptions) (*DownloadResult, error)
+}
+
+// NewQueue creates a queue that runs up to the downloader's concurrency
+// limit at once and lets each user have at most perUser jobs queued or
+// running. A perUser of 0 means no limit.
+func NewQueue(downloader *Downloader, perUser int) *Queue {
+	q := &Queue{
+		workers:  downloader.maxConcurrent,
+		perUser:  perUser,
+		download: downloader.DownloadVideoContext,
+	}
+	if q.workers < 1 {
+		q.workers = 1
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	for i := 0; i < q.workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+// Submit adds job to the end of the queue and gives it an ID. It returns
+// how many jobs are ahead of it, 0 if a worker starts it right away.
+func (q *Queue) Submit(job *Job) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, ErrQueueClosed
+	}
+
+	if job.Owner != "" && q.perUser > 0 && q.countLocked(job.Owner) >= q.perUser {
+		return 0, fmt.Errorf("you already have %d downloads in progress, wait for one to finish", q.perUser)
+	}
+
+	q.nextID++
+	job.ID = q.nextID
+	job.ctx, job.cancel = context.WithCancel(context.Background())
+
+	q.pending = append(q.pending, job)
+	q.cond.Signal()
+
+	// Idle workers take the jobs at the front of the queue first
+	position := len(q.pending) - (q.workers - len(q.running))
+	if position < 0 {
+		position = 0
+	}
+	return position, nil
+}
+
+// Position reports how many jobs are ahead of job, 0 once it is running,
+// and false if the queue no longer has it.
+func (q *Queue) Position(job *Job) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, running := range q.running {
+		if running == job {
+			return 0, true
+		}
+	}
+	for i, pending := range q.pending {
+		if pending == job {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// Get returns the job with the given ID while it is waiting or running.
+func (q *Queue) Get(id int) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, jobs := range [][]*Job{q.running, q.pending} {
+		for _, job := range jobs {
+			if job.ID == id {
+				return job, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Jobs returns the running jobs and the waiting ones, in queue order.
+func (q *Queue) Jobs() (running, pending []*Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	running = append(running, q.running...)
+	pending = append(pending, q.pending...)
+	return running, pending
+}
+
+// Cancel stops the job with the given ID. A waiting job is taken off the
+// queue; a running one has its yt-dlp process killed and partial files
+// removed. Either way its Done is called with ErrCancelled, unless Done was
+// already running, in which case its Context is cancelled. Cancel reports
+// false if no such job is waiting or running.
+func (q *Queue) Cancel(id int) bool {
+	q.mu.Lock()
+	for i, job := range q.pending {
+		if job.ID == id {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.mu.Unlock()
+
+			job.cancel()
+			if job.Done != nil {
+				job.Done(nil, ErrCancelled)
+			}
+			return true
+		}
+	}
+	for _, job := range q.running {
+		if job.ID == id {
+			q.mu.Unlock()
+
+			// The worker sees the download fail and reports it, or Done
+			// sees the context end
+			job.cancel()
+			return true
+		}
+	}
+	q.mu.Unlock()
+
+	return false
+}
+
+// Len reports how many jobs are waiting and how many are running.
+func (q *Queue) Len() (pending, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending), len(q.running)
+}
+
+// Close stops the queue. Running downloads finish, waiting ones fail
+// with ErrQueueClosed.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	for _, job := range pending {
+		job.cancel()
+		if job.Done != nil {
+			job.Done(nil, ErrQueueClosed)
+		}
+	}
+}
+
+func (q *Queue) countLocked(owner string) int {
+	count := 0
+	for _, jobs := range [][]*Job{q.pending, q.running} {
+		for _, job := range jobs {
+			if job.Owner == owner {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// work runs jobs one after another until the queue is closed
+func (q *Queue) work() {
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+
+		job := q.pending[0]
+		q.pending = q.pending[1:]
+		q.running = append(q.running, job)
+		q.mu.Unlock()
+
+		if job.Started != nil {
+			job.Started()
+		}
+
+		result, err := q.download(job.ctx, job.Options)
+		if job.ctx.Err() != nil {
+			// Cancelled just as it finished, so nobody wants the file
+			if result != nil {
+				result.Remove()
+			}
+			result, err = nil, ErrCancelled
+		}
+
+		// Done may shrink and upload the file, which takes a while too
+		if job.Done != nil {
+			job.Done(result, err)
+		}
+		job.cancel()
+
+		q.mu.Lock()
+		for i, running := range q.running {
+			if running == job {
+				q.running = append(q.running[:i], q.running[i+1:]...)
+				break
+			}
+		}
+		q.mu.Unlock()
+	}
+}
@@ -0,0 +1,263 @@
+package ytdlp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// blockingDownloads stands in for yt-dlp, finishing a download only when
+// told to
+type blockingDownloads struct {
+	started chan string
+	release chan struct{}
+}
+
+func newBlockingDownloads() *blockingDownloads {
+	return &blockingDownloads{started: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (b *blockingDownloads) download(ctx context.Context, opts DownloadOptions) (*DownloadResult, error) {
+	b.started <- opts.URL
+	select {
+	case <-b.release:
+		return &DownloadResult{Path: "/tmp/" + opts.URL}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func newTestQueue(workers, perUser int) (*Queue, *blockingDownloads) {
+	downloader := NewDownloader()
+	downloader.SetMaxConcurrent(workers)
+
+	downloads := newBlockingDownloads()
+	queue := NewQueue(downloader, perUser)
+	queue.download = downloads.download
+	return queue, downloads
+}
+
+func waitStarted(t *testing.T, downloads *blockingDownloads) string {
+	t.Helper()
+
+	select {
+	case url := <-downloads.started:
+		return url
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a download to start")
+		return ""
+	}
+}
+
+func TestQueueLimitsConcurrency(t *testing.T) {
+	queue, downloads := newTestQueue(2, 0)
+	defer queue.Close()
+
+	done := make(chan string, 3)
+	submit := func(url string) int {
+		position, err := queue.Submit(&Job{
+			Owner:   "user-" + url,
+			Options: DownloadOptions{URL: url},
+			Done: func(result *DownloadResult, err error) {
+				if err != nil {
+					t.Errorf("Download of %s failed: %v", url, err)
+					return
+				}
+				done <- result.Path
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to submit %s: %v", url, err)
+		}
+		return position
+	}
+
+	if position := submit("a"); position != 0 {
+		t.Errorf("Expected first job to start right away, got position %d", position)
+	}
+	waitStarted(t, downloads)
+	if position := submit("b"); position != 0 {
+		t.Errorf("Expected second job to start right away, got position %d", position)
+	}
+	waitStarted(t, downloads)
+
+	// Both workers are busy, so the third has to wait
+	if position := submit("c"); position != 1 {
+		t.Errorf("Expected third job to wait at position 1, got %d", position)
+	}
+	select {
+	case url := <-downloads.started:
+		t.Fatalf("Expected %s to wait for a free worker", url)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if pending, running := queue.Len(); pending != 1 || running != 2 {
+		t.Errorf("Expected 1 pending and 2 running, got %d and %d", pending, running)
+	}
+
+	downloads.release <- struct{}{}
+	if url := waitStarted(t, downloads); url != "c" {
+		t.Errorf("Expected c to start once a worker was free, got %s", url)
+	}
+
+	close(downloads.release)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for downloads to finish")
+		}
+	}
+}
+
+func TestQueuePerUserLimit(t *testing.T) {
+	queue, downloads := newTestQueue(1, 2)
+	defer close(downloads.release)
+
+	first := &Job{Owner: "user", Options: DownloadOptions{URL: "a"}}
+	second := &Job{Owner: "user", Options: DownloadOptions{URL: "b"}}
+
+	queue.Submit(first)
+	waitStarted(t, downloads)
+	if position, err := queue.Submit(second); err != nil || position != 1 {
+		t.Errorf("Expected second job at position 1, got %d (%v)", position, err)
+	}
+
+	if _, err := queue.Submit(&Job{Owner: "user", Options: DownloadOptions{URL: "c"}}); err == nil {
+		t.Error("Expected error over the per-user limit, got nil")
+	}
+
+	// Other users aren't held back by it
+	if _, err := queue.Submit(&Job{Owner: "other", Options: DownloadOptions{URL: "d"}}); err != nil {
+		t.Errorf("Expected another user's job to be queued, got %v", err)
+	}
+
+	if position, ok := queue.Position(first); !ok || position != 0 {
+		t.Errorf("Expected running job at position 0, got %d (%v)", position, ok)
+	}
+	if position, ok := queue.Position(second); !ok || position != 1 {
+		t.Errorf("Expected waiting job at position 1, got %d (%v)", position, ok)
+	}
+
+	// Closing fails the jobs that are still waiting
+	failed := make(chan error, 1)
+	waiting := &Job{Options: DownloadOptions{URL: "e"}, Done: func(result *DownloadResult, err error) { failed <- err }}
+	queue.Submit(waiting)
+	queue.Close()
+
+	if err := <-failed; err != ErrQueueClosed {
+		t.Errorf("Expected ErrQueueClosed for a waiting job, got %v", err)
+	}
+	if _, err := queue.Submit(&Job{}); err != ErrQueueClosed {
+		t.Errorf("Expected ErrQueueClosed after closing, got %v", err)
+	}
+}
+
+func TestQueueCancel(t *testing.T) {
+	queue, downloads := newTestQueue(1, 0)
+	defer close(downloads.release)
+	defer queue.Close()
+
+	results := make(chan error, 2)
+	done := func(result *DownloadResult, err error) { results <- err }
+
+	running := &Job{Owner: "user", Options: DownloadOptions{URL: "a"}, Done: done}
+	waiting := &Job{Owner: "other", Options: DownloadOptions{URL: "b"}, Done: done}
+	queue.Submit(running)
+	waitStarted(t, downloads)
+	queue.Submit(waiting)
+
+	if running.ID == 0 || waiting.ID == running.ID {
+		t.Fatalf("Expected distinct job IDs, got %d and %d", running.ID, waiting.ID)
+	}
+	if job, ok := queue.Get(waiting.ID); !ok || job != waiting {
+		t.Errorf("Expected to find job %d", waiting.ID)
+	}
+
+	active, pending := queue.Jobs()
+	if len(active) != 1 || active[0] != running || len(pending) != 1 || pending[0] != waiting {
+		t.Errorf("Expected one running and one waiting job, got %v and %v", active, pending)
+	}
+
+	// A waiting job never starts
+	if !queue.Cancel(waiting.ID) {
+		t.Fatal("Expected waiting job to be cancelled")
+	}
+	if err := <-results; err != ErrCancelled {
+		t.Errorf("Expected ErrCancelled for the waiting job, got %v", err)
+	}
+
+	// A running one has its download stopped
+	if !queue.Cancel(running.ID) {
+		t.Fatal("Expected running job to be cancelled")
+	}
+	select {
+	case err := <-results:
+		if err != ErrCancelled {
+			t.Errorf("Expected ErrCancelled for the running job, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the running job to stop")
+	}
+
+	waitIdle(t, queue)
+	if queue.Cancel(running.ID) {
+		t.Error("Expected a finished job not to be found")
+	}
+}
+
+func TestQueueKeepsJobUntilDone(t *testing.T) {
+	queue, downloads := newTestQueue(1, 1)
+	defer close(downloads.release)
+	defer queue.Close()
+
+	// Done stands in for shrinking and uploading the file
+	inDone := make(chan struct{})
+	finish := make(chan struct{})
+	job := &Job{
+		Owner:   "user",
+		Options: DownloadOptions{URL: "a"},
+		Done: func(result *DownloadResult, err error) {
+			close(inDone)
+			<-finish
+		},
+	}
+	queue.Submit(job)
+	waitStarted(t, downloads)
+	downloads.release <- struct{}{}
+	<-inDone
+
+	if active, _ := queue.Jobs(); len(active) != 1 || active[0] != job {
+		t.Errorf("Expected the job to still be running while Done runs, got %v", active)
+	}
+	if _, err := queue.Submit(&Job{Owner: "user", Options: DownloadOptions{URL: "b"}}); err == nil {
+		t.Error("Expected the job to still count against its owner while Done runs")
+	}
+
+	if !queue.Cancel(job.ID) {
+		t.Fatal("Expected the job to be cancellable while Done runs")
+	}
+	select {
+	case <-job.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected cancelling to end the job's context")
+	}
+
+	close(finish)
+	waitIdle(t, queue)
+}
+
+func waitIdle(t *testing.T, queue *Queue) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if pending, running := queue.Len(); pending == 0 && running == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the queue to empty")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,77 @@
+package ytdlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DownloadResult describes a finished download.
+type DownloadResult struct {
+	Path     string        // The finished file, after merging and converting
+	Size     int64         // Size of the file in bytes
+	Format   string        // yt-dlp format ID, e.g. "137+140" when video and audio were merged
+	Duration time.Duration // Playing time, 0 if unknown
+	Info     *VideoInfo    // Metadata of what was downloaded
+
+	dir string // Job directory made for the download, "" if the caller chose one
+}
+
+// Remove deletes the downloaded file. If the downloader made a job
+// directory for it, the directory goes too, with anything else in it.
+func (r *DownloadResult) Remove() error {
+	if r.dir != "" {
+		return os.RemoveAll(r.dir)
+	}
+	return os.Remove(r.Path)
+}
+
+// downloadedInfo is the info dict yt-dlp prints once the file is in its
+// final place.
+type downloadedInfo struct {
+	VideoInfo
+	Filepath string `json:"filepath"`
+	FormatID string `json:"format_id"`
+}
+
+// readResult reads what yt-dlp wrote to path with --print-to-file
+// after_move:%()j. Only the last video printed counts.
+func readResult(path string) (*DownloadResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read download result: %v", err)
+	}
+
+	return parseResult(data)
+}
+
+func parseResult(data []byte) (*DownloadResult, error) {
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	last := lines[len(lines)-1]
+	if len(last) == 0 {
+		return nil, fmt.Errorf("could not determine output filename")
+	}
+
+	var info downloadedInfo
+	if err := json.Unmarshal(last, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse download result: %v", err)
+	}
+	if info.Filepath == "" {
+		return nil, fmt.Errorf("could not determine output filename")
+	}
+
+	stat, err := os.Stat(info.Filepath)
+	if err != nil {
+		return nil, fmt.Errorf("downloaded file is missing: %v", err)
+	}
+
+	return &DownloadResult{
+		Path:     info.Filepath,
+		Size:     stat.Size(),
+		Format:   info.FormatID,
+		Duration: time.Duration(info.Duration * float64(time.Second)),
+		Info:     &info.VideoInfo,
+	}, nil
+}
@@ -0,0 +1,189 @@
+package ytdlp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shrinkOverhead is the share of the size budget kept free for container
+// overhead and bitrate overshoot
+const shrinkOverhead = 0.07
+
+// Lowest bitrates, in kbit/s, worth sending anyone
+const (
+	minAudioBitrate = 32
+	minVideoBitrate = 100
+)
+
+// encodePlan is how a file gets re-encoded to fit a size limit. Bitrates
+// are in kbit/s; Height is 0 for audio.
+type encodePlan struct {
+	AudioBitrate int
+	VideoBitrate int
+	Height       int
+}
+
+// planEncode picks bitrates that fit duration into limit bytes, and for
+// video a resolution that suits the bitrate left for it.
+func planEncode(limit int64, duration time.Duration, audio bool) (encodePlan, error) {
+	if duration <= 0 {
+		return encodePlan{}, fmt.Errorf("unknown duration")
+	}
+
+	budget := int(float64(limit) * 8 / 1000 * (1 - shrinkOverhead) / duration.Seconds())
+
+	if audio {
+		if budget < minAudioBitrate {
+			return encodePlan{}, fmt.Errorf("%s of audio can't fit in %s", formatLength(duration), FormatBytes(limit))
+		}
+		if budget > 192 {
+			budget = 192
+		}
+		return encodePlan{AudioBitrate: budget}, nil
+	}
+
+	plan := encodePlan{AudioBitrate: 96}
+	switch {
+	case budget < 300:
+		plan.AudioBitrate = 32
+	case budget < 600:
+		plan.AudioBitrate = 64
+	}
+
+	plan.VideoBitrate = budget - plan.AudioBitrate
+	if plan.VideoBitrate < minVideoBitrate {
+		return encodePlan{}, fmt.Errorf("%s of video can't fit in %s", formatLength(duration), FormatBytes(limit))
+	}
+
+	switch {
+	case plan.VideoBitrate >= 2500:
+		plan.Height = 720
+	case plan.VideoBitrate >= 1200:
+		plan.Height = 480
+	case plan.VideoBitrate >= 600:
+		plan.Height = 360
+	default:
+		plan.Height = 240
+	}
+
+	return plan, nil
+}
+
+// scale lowers the plan's bitrates by factor, for another try when the
+// first encode came out too big
+func (p encodePlan) scale(factor float64) encodePlan {
+	p.VideoBitrate = int(float64(p.VideoBitrate) * factor)
+	if p.Height == 0 {
+		p.AudioBitrate = int(float64(p.AudioBitrate) * factor)
+	}
+	return p
+}
+
+// encodeArgs returns the ffmpeg arguments to encode input to output
+func encodeArgs(input, output string, plan encodePlan) []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-y", "-i", input}
+
+	if plan.Height == 0 {
+		return append(args, "-vn", "-c:a", "libmp3lame", "-b:a", fmt.Sprintf("%dk", plan.AudioBitrate), output)
+	}
+
+	video := fmt.Sprintf("%dk", plan.VideoBitrate)
+	buffer := fmt.Sprintf("%dk", plan.VideoBitrate*2)
+	return append(args,
+		// Never scale up, and keep the width even as x264 requires
+		"-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", plan.Height),
+		"-c:v", "libx264", "-preset", "veryfast",
+		"-b:v", video, "-maxrate", video, "-bufsize", buffer,
+		"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", plan.AudioBitrate),
+		"-movflags", "+faststart",
+		output,
+	)
+}
+
+// ShrinkToFit re-encodes the file at path to at most limit bytes, lowering
+// the bitrate and, for video, the resolution. The smaller file is written
+// next to the original, which is left alone, and its path returned. A
+// duration of 0 is looked up with ffprobe. Cancelling ctx stops ffmpeg and
+// ffprobe.
+func ShrinkToFit(ctx context.Context, path string, duration time.Duration, limit int64, audio bool) (string, error) {
+	if duration <= 0 {
+		var err error
+		if duration, err = probeDuration(ctx, path); err != nil {
+			return "", err
+		}
+	}
+
+	plan, err := planEncode(limit, duration, audio)
+	if err != nil {
+		return "", err
+	}
+
+	ext := ".mp4"
+	if audio {
+		ext = ".mp3"
+	}
+	output := strings.TrimSuffix(path, filepath.Ext(path)) + ".small" + ext
+
+	// Bitrates are a target rather than a promise, so try once more lower
+	for attempt := 0; attempt < 2; attempt++ {
+		cmd := exec.CommandContext(ctx, "ffmpeg", encodeArgs(path, output, plan)...)
+		killProcessGroup(cmd)
+		cmd.WaitDelay = 5 * time.Second
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.Remove(output)
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", fmt.Errorf("failed to re-encode: %v, output: %s", err, string(out))
+		}
+
+		info, err := os.Stat(output)
+		if err != nil {
+			return "", err
+		}
+		if info.Size() <= limit {
+			return output, nil
+		}
+
+		plan = plan.scale(0.75)
+	}
+
+	os.Remove(output)
+	return "", fmt.Errorf("re-encoded file is still over %s", FormatBytes(limit))
+}
+
+// probeDuration asks ffprobe how long a media file plays for
+func probeDuration(ctx context.Context, path string) (time.Duration, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = 5 * time.Second
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, fmt.Errorf("failed to read duration: %v, output: %s", err, commandStderr(err))
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read duration: %v", err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// formatLength renders a duration like "1:02:03" or "4:05"
+func formatLength(d time.Duration) string {
+	seconds := int(d.Seconds())
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,115 @@
+package ytdlp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanEncode(t *testing.T) {
+	const mib = 1024 * 1024
+
+	tests := []struct {
+		name     string
+		limit    int64
+		duration time.Duration
+		audio    bool
+		expected encodePlan
+	}{
+		{"short song keeps a good bitrate", 10 * mib, 4 * time.Minute, true, encodePlan{AudioBitrate: 192}},
+		{"short clip stays at 720p", 50 * mib, time.Minute, false, encodePlan{AudioBitrate: 96, VideoBitrate: 6405, Height: 720}},
+		{"longer video drops to 360p", 25 * mib, 3 * time.Minute, false, encodePlan{AudioBitrate: 96, VideoBitrate: 987, Height: 360}},
+		{"long video squeezes the audio too", 10 * mib, 5 * time.Minute, false, encodePlan{AudioBitrate: 32, VideoBitrate: 228, Height: 240}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planEncode(tt.limit, tt.duration, tt.audio)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if plan != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, plan)
+			}
+		})
+	}
+}
+
+func TestPlanEncodeTooLong(t *testing.T) {
+	if _, err := planEncode(10*1024*1024, time.Hour, true); err == nil || !strings.Contains(err.Error(), "1:00:00 of audio") {
+		t.Errorf("Expected an hour of audio not to fit, got %v", err)
+	}
+
+	if _, err := planEncode(10*1024*1024, 20*time.Minute, false); err == nil {
+		t.Error("Expected 20 minutes of video not to fit")
+	}
+
+	if _, err := planEncode(10*1024*1024, 0, false); err == nil {
+		t.Error("Expected an unknown duration to be refused")
+	}
+}
+
+func TestEncodeArgs(t *testing.T) {
+	args := strings.Join(encodeArgs("in.webm", "out.mp4", encodePlan{AudioBitrate: 64, VideoBitrate: 500, Height: 360}), " ")
+	for _, expected := range []string{"-i in.webm", "scale=-2:'min(360,ih)'", "-b:v 500k", "-bufsize 1000k", "-b:a 64k"} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("Expected %q in %s", expected, args)
+		}
+	}
+	if !strings.HasSuffix(args, "out.mp4") {
+		t.Errorf("Expected the output last, got %s", args)
+	}
+
+	args = strings.Join(encodeArgs("in.m4a", "out.mp3", encodePlan{AudioBitrate: 96}), " ")
+	if !strings.Contains(args, "-vn -c:a libmp3lame -b:a 96k") {
+		t.Errorf("Expected an audio-only encode, got %s", args)
+	}
+}
+
+func TestShrinkToFitCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg is a shell script")
+	}
+
+	// The child holds ffmpeg's output open, like the encoder threads of a
+	// hung ffmpeg would
+	dir := t.TempDir()
+	started := filepath.Join(dir, "started")
+	script := "#!/bin/sh\nsleep 30 &\ntouch " + started + "\nwait\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		_, err := ShrinkToFit(ctx, filepath.Join(dir, "video.mp4"), time.Minute, 10*1024*1024, false)
+		result <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(started); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for ffmpeg to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the re-encode to stop")
+	}
+}